@@ -0,0 +1,100 @@
+package goloc
+
+import (
+	"context"
+	"net/http"
+)
+
+type langKey struct{}
+
+// WithLang returns a copy of ctx which carries lang, for use with T and Tf.
+func WithLang(ctx context.Context, lang string) context.Context {
+	return context.WithValue(ctx, langKey{}, lang)
+}
+
+// LangFrom returns the language stored in ctx by WithLang, or the bundle's default language.
+func (b *Bundle) LangFrom(ctx context.Context) string {
+	if lang, ok := ctx.Value(langKey{}).(string); ok && lang != "" {
+		return lang
+	}
+	return b.defaultLang()
+}
+
+// T translates a string into the language stored in ctx.
+func (b *Bundle) T(ctx context.Context, trnlVal string) string {
+	return b.Trnl(b.LangFrom(ctx), trnlVal)
+}
+
+// Tf is like Trnlf, using the language stored in ctx.
+func (b *Bundle) Tf(ctx context.Context, trnlVal string, dataMap map[string]string) string {
+	return b.Trnlf(b.LangFrom(ctx), trnlVal, dataMap)
+}
+
+// Tfv is like Trnlfv, using the language stored in ctx.
+func (b *Bundle) Tfv(ctx context.Context, trnlVal string, args ...interface{}) string {
+	return b.Trnlfv(b.LangFrom(ctx), trnlVal, args...)
+}
+
+func (b *Bundle) langParam() string {
+	if b.LangParam != "" {
+		return b.LangParam
+	}
+	return "lang"
+}
+
+func (b *Bundle) langCookie() string {
+	if b.LangCookie != "" {
+		return b.LangCookie
+	}
+	return "lang"
+}
+
+// Negotiate picks the supported language which best fits a request. The query parameter named by LangParam is checked
+// first, then the cookie named by LangCookie, then the Accept-Language header.
+func (b *Bundle) Negotiate(r *http.Request) string {
+	if q := r.URL.Query().Get(b.langParam()); q != "" {
+		if lang, ok := b.match(q); ok {
+			return lang
+		}
+	}
+	if c, err := r.Cookie(b.langCookie()); err == nil && c.Value != "" {
+		if lang, ok := b.match(c.Value); ok {
+			return lang
+		}
+	}
+	if h := r.Header.Get("Accept-Language"); h != "" {
+		if lang, ok := b.match(h); ok {
+			return lang
+		}
+	}
+	return b.defaultLang()
+}
+
+// Middleware stores the negotiated language of each request in its context, so handlers can use T and Tf.
+func (b *Bundle) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		next.ServeHTTP(w, r.WithContext(WithLang(r.Context(), b.Negotiate(r))))
+	})
+}
+
+// LangFrom returns the language stored in ctx, or the default language.
+func LangFrom(ctx context.Context) string {
+	return std.LangFrom(ctx)
+}
+
+func T(ctx context.Context, trnlVal string) string {
+	return std.T(ctx, trnlVal)
+}
+
+func Tf(ctx context.Context, trnlVal string, dataMap map[string]string) string {
+	return std.Tf(ctx, trnlVal, dataMap)
+}
+
+func Tfv(ctx context.Context, trnlVal string, args ...interface{}) string {
+	return std.Tfv(ctx, trnlVal, args...)
+}
+
+// Middleware negotiates request languages against the default bundle.
+func Middleware(next http.Handler) http.Handler {
+	return std.Middleware(next)
+}
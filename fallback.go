@@ -0,0 +1,116 @@
+package goloc
+
+import (
+	"sync"
+
+	"golang.org/x/text/language"
+)
+
+// langCache holds everything derived from the set of loaded languages. It is replaced whenever a new language is
+// loaded, so it never needs invalidating.
+type langCache struct {
+	chains sync.Map // lang:[]string
+
+	matcherOnce sync.Once
+	matcher     language.Matcher
+	matcherKeys []string // loaded language for each tag given to the matcher
+}
+
+// chain returns the languages to try, in order, when looking up a string in lang. It starts with lang itself, walks
+// up the BCP 47 parents (pt-BR -> pt), following any explicit Fallbacks along the way, and ends with the default
+// language. Only loaded languages are returned. Must be called with b.mu held.
+func (b *Bundle) chain(lang string) []string {
+	if c, ok := b.cache.chains.Load(lang); ok {
+		return c.([]string)
+	}
+
+	tags := make(map[string]string, len(b.data)) // canonical tag:loaded language
+	for k := range b.data {
+		tags[language.Make(k).String()] = k
+	}
+	fallbacks := make(map[string][]string, len(b.Fallbacks)) // canonical tag:fallbacks
+	for k, v := range b.Fallbacks {
+		t := language.Make(k).String()
+		fallbacks[t] = append(fallbacks[t], v...)
+	}
+
+	var out []string
+	added := map[string]bool{}
+	visited := map[language.Tag]bool{}
+	add := func(l string) {
+		if !added[l] {
+			added[l] = true
+			out = append(out, l)
+		}
+	}
+	var walk func(l string)
+	walk = func(l string) {
+		if _, ok := b.data[l]; ok {
+			add(l)
+		}
+		for t := language.Make(l); t != language.Und && !visited[t]; t = t.Parent() {
+			visited[t] = true
+			if k, ok := tags[t.String()]; ok {
+				add(k)
+			}
+			for _, fb := range fallbacks[t.String()] {
+				walk(fb)
+			}
+		}
+	}
+	walk(lang)
+	walk(b.defaultLang())
+
+	b.cache.chains.Store(lang, out)
+	return out
+}
+
+// Match returns the supported language which best matches the given user preferences. Each argument can be a single
+// language tag, such as a Telegram language_code, or a full Accept-Language header. If nothing matches, the default
+// language is returned.
+func (b *Bundle) Match(userTags ...string) string {
+	lang, _ := b.match(userTags...)
+	return lang
+}
+
+// match is like Match, but also reports whether any supported language matched.
+func (b *Bundle) match(userTags ...string) (string, bool) {
+	var tags []language.Tag
+	for _, s := range userTags {
+		ts, _, err := language.ParseAcceptLanguage(s)
+		if err != nil {
+			continue
+		}
+		tags = append(tags, ts...)
+	}
+
+	b.mu.RLock()
+	c := b.cache
+	b.mu.RUnlock()
+	c.matcherOnce.Do(func() {
+		// the first supported tag is used when nothing else matches, so default goes first.
+		keys := []string{b.defaultLang()}
+		for _, l := range b.Languages() {
+			if l != b.defaultLang() && language.Make(l) != language.Und {
+				keys = append(keys, l)
+			}
+		}
+		supported := make([]language.Tag, len(keys))
+		for i, k := range keys {
+			supported[i] = language.Make(k)
+		}
+		c.matcher = language.NewMatcher(supported)
+		c.matcherKeys = keys
+	})
+
+	_, idx, conf := c.matcher.Match(tags...)
+	if conf == language.No {
+		return b.defaultLang(), false
+	}
+	return c.matcherKeys[idx], true
+}
+
+// Match returns the language of the default bundle which best matches the given user preferences.
+func Match(userTags ...string) string {
+	return std.Match(userTags...)
+}
@@ -0,0 +1,297 @@
+package goloc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// fmtVerbs lists every verb understood by fmt.Sprintf.
+const fmtVerbs = "vTtbcdoOqxXUeEfFgGsp"
+
+// fmtDirective is a single directive of a fmt format string, such as %-5.2f or %[2]*d.
+type fmtDirective struct {
+	text  string // the directive without explicit argument indexes, as passed to fmt.Sprintf
+	verb  rune
+	args  []int // indexes of the arguments used, including those for * widths and precisions
+	plain bool  // no flags, width or precision
+}
+
+// parseFmtDirective parses the directive following a %. argNum is the index of the next argument, and is updated the
+// way fmt does; nArgs is the number of arguments available. It returns the number of runes read.
+func parseFmtDirective(s []rune, argNum *int, nArgs int) (fmtDirective, int, error) {
+	d := fmtDirective{plain: true}
+	var text strings.Builder
+	text.WriteRune('%')
+	i := 0
+
+	// argIndex handles an explicit [n] argument index.
+	argIndex := func() error {
+		if i >= len(s) || s[i] != '[' {
+			return nil
+		}
+		end := i + 1
+		for end < len(s) && s[end] != ']' {
+			end++
+		}
+		if end == len(s) {
+			return errors.New("unterminated argument index")
+		}
+		n, err := strconv.Atoi(string(s[i+1 : end]))
+		if err != nil || n < 1 || n > nArgs {
+			return fmt.Errorf("bad argument index %s", string(s[i:end+1]))
+		}
+		*argNum = n - 1
+		i = end + 1
+		return nil
+	}
+	// nextArg consumes the next argument.
+	nextArg := func() error {
+		if *argNum >= nArgs {
+			return errors.New("missing argument")
+		}
+		d.args = append(d.args, *argNum)
+		*argNum++
+		return nil
+	}
+	// number handles a width or precision, which is either a number or a * argument.
+	number := func() error {
+		if err := argIndex(); err != nil {
+			return err
+		}
+		if i < len(s) && s[i] == '*' {
+			d.plain = false
+			text.WriteRune('*')
+			i++
+			return nextArg()
+		}
+		for ; i < len(s) && s[i] >= '0' && s[i] <= '9'; i++ {
+			d.plain = false
+			text.WriteRune(s[i])
+		}
+		return nil
+	}
+
+	for ; i < len(s) && strings.ContainsRune("#0+- ", s[i]); i++ {
+		d.plain = false
+		text.WriteRune(s[i])
+	}
+	if err := number(); err != nil {
+		return d, i, err
+	}
+	if i < len(s) && s[i] == '.' {
+		d.plain = false
+		text.WriteRune('.')
+		i++
+		if err := number(); err != nil {
+			return d, i, err
+		}
+	}
+	if err := argIndex(); err != nil {
+		return d, i, err
+	}
+
+	if i >= len(s) {
+		return d, i, errors.New("missing verb")
+	}
+	d.verb = s[i]
+	i++
+	text.WriteRune(d.verb)
+	d.text = text.String()
+	switch {
+	case d.verb == '%':
+		return d, i, nil
+	case d.verb == 'w':
+		return d, i, errors.New("%w can't be translated, since the wrapped error would be lost")
+	case !strings.ContainsRune(fmtVerbs, d.verb):
+		return d, i, fmt.Errorf("unknown verb %%%c", d.verb)
+	}
+	return d, i, nextArg()
+}
+
+// convert returns the expression passed for the directive: the argument itself where the translation formats it the
+// same way, or a call converting it to a string. Trnlfv formats plain arguments itself, numbers for the locale, so
+// they're passed as they are unless it would print them differently, such as a []byte with %s. Shortcuts such as
+// strconv.Itoa are only taken for arguments of the exact type they expect. Any package the expression needs is
+// returned too.
+func (d fmtDirective) convert(info *types.Info, fmtArgs []ast.Expr, variadic bool) (ast.Expr, string) {
+	if len(d.args) == 1 && d.plain {
+		arg := fmtArgs[d.args[0]]
+		switch {
+		case variadic && d.formattedByTrnlfv(info, arg):
+			return arg, ""
+		case d.verb == 's' && hasBasicType(info, arg, types.String, types.UntypedString):
+			return arg, ""
+		case d.verb == 'd' && hasBasicType(info, arg, types.Int, types.UntypedInt, types.UntypedRune):
+			return pkgCall("strconv", "Itoa", arg), "strconv"
+		case d.verb == 't' && hasBasicType(info, arg, types.Bool, types.UntypedBool):
+			return pkgCall("strconv", "FormatBool", arg), "strconv"
+		case d.verb == 'v':
+			return pkgCall("fmt", "Sprint", arg), "fmt"
+		}
+	}
+
+	args := []ast.Expr{&ast.BasicLit{Kind: token.STRING, Value: strconv.Quote(d.text)}}
+	for _, a := range d.args {
+		args = append(args, fmtArgs[a])
+	}
+	return pkgCall("fmt", "Sprintf", args...), "fmt"
+}
+
+// formattedByTrnlfv reports whether Trnlfv prints arg the way the directive does, apart from formatting numbers for
+// the locale.
+func (d fmtDirective) formattedByTrnlfv(info *types.Info, arg ast.Expr) bool {
+	switch d.verb {
+	case 'v':
+		return true
+	case 's':
+		t := typeOf(info, arg)
+		return t != nil && !isBytes(t)
+	case 'd':
+		b := basicType(info, arg)
+		return b != nil && b.Info()&types.IsInteger != 0
+	case 't':
+		return hasBasicType(info, arg, types.Bool, types.UntypedBool)
+	}
+	return false
+}
+
+// isBytes reports whether t is a slice of bytes, which %s prints as a string.
+func isBytes(t types.Type) bool {
+	s, ok := t.Underlying().(*types.Slice)
+	if !ok {
+		return false
+	}
+	b, ok := s.Elem().Underlying().(*types.Basic)
+	return ok && b.Kind() == types.Byte
+}
+
+// isLocaleNumber reports whether the directive is a plain %d of an unnamed integer type, which the translation can
+// format for the locale.
+func (d fmtDirective) isLocaleNumber(info *types.Info, fmtArgs []ast.Expr) bool {
+	if d.verb != 'd' || !d.plain || len(d.args) != 1 {
+		return false
+	}
+	b := basicType(info, fmtArgs[d.args[0]])
+	return b != nil && b.Info()&types.IsInteger != 0
+}
+
+// basicType returns the type of expr if it's a basic type. Named types don't count, since they can't be passed where
+// the basic type is expected; neither does anything without type information.
+func basicType(info *types.Info, expr ast.Expr) *types.Basic {
+	t := typeOf(info, expr)
+	if t == nil {
+		return nil
+	}
+	b, _ := types.Unalias(t).(*types.Basic)
+	return b
+}
+
+// typeOf returns the type of expr, or nil without type information.
+func typeOf(info *types.Info, expr ast.Expr) types.Type {
+	if info == nil {
+		return nil
+	}
+	return info.TypeOf(expr)
+}
+
+// hasBasicType reports whether expr has one of the basic types kinds.
+func hasBasicType(info *types.Info, expr ast.Expr, kinds ...types.BasicKind) bool {
+	b := basicType(info, expr)
+	if b == nil {
+		return false
+	}
+	for _, k := range kinds {
+		if b.Kind() == k {
+			return true
+		}
+	}
+	return false
+}
+
+func pkgCall(pkg string, name string, args ...ast.Expr) *ast.CallExpr {
+	return &ast.CallExpr{
+		Fun: &ast.SelectorExpr{
+			X:   &ast.Ident{Name: pkg},
+			Sel: &ast.Ident{Name: name},
+		},
+		Args: args,
+	}
+}
+
+// parseFmtString replaces the directives in rdata with {n} placeholders, for the format arguments fmtArgs, and turns
+// %% into %. The returned data holds the key-value pairs for a Trnlf map, or just the arguments for Trnlfv when
+// variadic is set, along with the packages they need. Every fmt verb, flag, width, precision and argument index is
+// supported; directives which can't be converted, such as %w, are returned as errors. The types of the arguments are
+// read from info, to pick conversions which compile.
+//
+// For Trnlf maps, arguments are formatted the way fmt does, unless localeNumbers is set: plain %d integers then get a
+// {n, number, integer} placeholder instead, which formats them for the locale, such as 2,024 in English. Since that
+// makes the message an ICU one, its apostrophes are doubled. Trnlfv formats numbers for the locale either way.
+func parseFmtString(info *types.Info, rdata []rune, fmtArgs []ast.Expr, variadic bool, localeNumbers bool) (newData []rune, mapData []ast.Expr, imports []string, err error) {
+	argNum := 0
+	used := make([]bool, len(fmtArgs))
+	placeholders := make(map[string]int) // directive and args:placeholder
+	typed := false                       // a placeholder has a type, so apostrophes need escaping
+	for i := 0; i < len(rdata); i++ {
+		if rdata[i] != '%' {
+			newData = append(newData, rdata[i])
+			continue
+		}
+		d, n, err := parseFmtDirective(rdata[i+1:], &argNum, len(fmtArgs))
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("%s in %q", err.Error(), string(rdata))
+		}
+		i += n
+		if d.verb == '%' {
+			newData = append(newData, '%')
+			continue
+		}
+
+		localeNumber := localeNumbers && d.isLocaleNumber(info, fmtArgs)
+		key := fmt.Sprint(d.text, d.args)
+		index, ok := placeholders[key]
+		if !ok {
+			index = len(placeholders) + 1
+			placeholders[key] = index
+
+			expr, imp := d.convert(info, fmtArgs, variadic)
+			if imp != "" && !contains(imports, imp) {
+				imports = append(imports, imp)
+			}
+			if variadic {
+				mapData = append(mapData, expr)
+			} else {
+				mapData = append(mapData, &ast.KeyValueExpr{
+					Key: &ast.BasicLit{
+						Kind:  token.STRING,
+						Value: strconv.Quote(strconv.Itoa(index)),
+					},
+					Value: expr,
+				})
+			}
+			for _, a := range d.args {
+				used[a] = true
+			}
+		}
+		if localeNumber {
+			typed = true
+			newData = append(newData, []rune("{"+strconv.Itoa(index)+", number, integer}")...)
+		} else {
+			newData = append(newData, []rune("{"+strconv.Itoa(index)+"}")...)
+		}
+	}
+	if typed {
+		newData = []rune(strings.ReplaceAll(string(newData), "'", "''"))
+	}
+	for i, u := range used {
+		if !u {
+			return nil, nil, nil, fmt.Errorf("argument %d is not used by %q", i+1, string(rdata))
+		}
+	}
+	return newData, mapData, imports, nil
+}
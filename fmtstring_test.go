@@ -0,0 +1,124 @@
+package goloc
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strings"
+	"testing"
+)
+
+// fmtTestDecls declares the variables the format arguments of the tests can use.
+const fmtTestDecls = `
+type Flag bool
+type Name string
+
+var (
+	i   int
+	i64 int64
+	s   string
+	b   bool
+	f   Flag
+	n   Name
+	e   error
+	bs  []byte
+	fl  float64
+)
+`
+
+// checkFmtArgs type-checks the comma-separated expressions args, and returns them along with their type information.
+func checkFmtArgs(t *testing.T, args string) ([]ast.Expr, *types.Info) {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", "package p\n"+fmtTestDecls+"var _ = []interface{}{"+args+"}\n", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &types.Info{Types: make(map[ast.Expr]types.TypeAndValue)}
+	if _, err := new(types.Config).Check("p", fset, []*ast.File{f}, info); err != nil {
+		t.Fatal(err)
+	}
+	decl := f.Decls[len(f.Decls)-1].(*ast.GenDecl)
+	lit := decl.Specs[0].(*ast.ValueSpec).Values[0].(*ast.CompositeLit)
+	return lit.Elts, info
+}
+
+func TestParseFmtString(t *testing.T) {
+	tests := []struct {
+		format   string
+		args     string
+		variadic bool
+		numbers  bool
+		want     string
+		wantArgs []string
+	}{
+		{"Hello %s", "s", false, false, "Hello {1}", []string{`"1": s`}},
+		{"%d files", "i", false, false, "{1} files", []string{`"1": strconv.Itoa(i)`}},
+		{"%d files", "3", false, false, "{1} files", []string{`"1": strconv.Itoa(3)`}},
+		{"%d files", "i64", false, false, "{1} files", []string{`"1": fmt.Sprintf("%d", i64)`}},
+		{"%t", "b", false, false, "{1}", []string{`"1": strconv.FormatBool(b)`}},
+		{"%t", "f", false, false, "{1}", []string{`"1": fmt.Sprintf("%t", f)`}},
+		{"%s", "n", false, false, "{1}", []string{`"1": fmt.Sprintf("%s", n)`}},
+		{"%s", "e", false, false, "{1}", []string{`"1": fmt.Sprintf("%s", e)`}},
+		{"%s", "bs", false, false, "{1}", []string{`"1": fmt.Sprintf("%s", bs)`}},
+		{"%v", "fl", false, false, "{1}", []string{`"1": fmt.Sprint(fl)`}},
+		{"%.2f%%", "fl", false, false, "{1}%", []string{`"1": fmt.Sprintf("%.2f", fl)`}},
+		{"%-5s|", "s", false, false, "{1}|", []string{`"1": fmt.Sprintf("%-5s", s)`}},
+		{"%*d", "i, i", false, false, "{1}", []string{`"1": fmt.Sprintf("%*d", i, i)`}},
+		{"%[2]s %[1]s", "s, n", false, false, "{1} {2}", []string{`"1": fmt.Sprintf("%s", n)`, `"2": s`}},
+		{"%s and %[1]s", "s", false, false, "{1} and {1}", []string{`"1": s`}},
+		{"%s, %d", "s, i64", true, false, "{1}, {2}", []string{`s`, `i64`}},
+		{"%d", "i", true, false, "{1}", []string{`i`}},
+		{"%t %v %s", "b, fl, e", true, false, "{1} {2} {3}", []string{`b`, `fl`, `e`}},
+		{"%s %s", "n, bs", true, false, "{1} {2}", []string{`n`, `fmt.Sprintf("%s", bs)`}},
+		{"%t %d", "f, fl", true, false, "{1} {2}", []string{`fmt.Sprintf("%t", f)`, `fmt.Sprintf("%d", fl)`}},
+		{"Year %d", "i", true, true, "Year {1, number, integer}", []string{`i`}},
+		{"Year %d", "i64", false, true, "Year {1, number, integer}", []string{`"1": fmt.Sprintf("%d", i64)`}},
+		{"it's %d", "i", true, true, "it''s {1, number, integer}", []string{`i`}},
+		{"it's %05d", "i", true, true, "it's {1}", []string{`fmt.Sprintf("%05d", i)`}},
+	}
+	for _, tt := range tests {
+		fmtArgs, info := checkFmtArgs(t, tt.args)
+		data, mapData, _, err := parseFmtString(info, []rune(tt.format), fmtArgs, tt.variadic, tt.numbers)
+		if err != nil {
+			t.Errorf("parseFmtString(%q, %s): %v", tt.format, tt.args, err)
+			continue
+		}
+		var gotArgs []string
+		for _, e := range mapData {
+			var buf bytes.Buffer
+			if err := printer.Fprint(&buf, token.NewFileSet(), e); err != nil {
+				t.Fatal(err)
+			}
+			gotArgs = append(gotArgs, buf.String())
+		}
+		if string(data) != tt.want || strings.Join(gotArgs, "; ") != strings.Join(tt.wantArgs, "; ") {
+			t.Errorf("parseFmtString(%q, %s) = %q with %q, want %q with %q",
+				tt.format, tt.args, string(data), gotArgs, tt.want, tt.wantArgs)
+		}
+	}
+}
+
+func TestParseFmtStringErrors(t *testing.T) {
+	tests := []struct {
+		format string
+		args   string
+	}{
+		{"%w", "e"},
+		{"%d %d", "i"},
+		{"%s", "s, i"},
+		{"%[3]s", "s, i"},
+		{"%[1s", "s"},
+		{"%y", "i"},
+		{"%", "i"},
+	}
+	for _, tt := range tests {
+		fmtArgs, info := checkFmtArgs(t, tt.args)
+		if _, _, _, err := parseFmtString(info, []rune(tt.format), fmtArgs, false, false); err == nil {
+			t.Errorf("parseFmtString(%q, %s) succeeded, want an error", tt.format, tt.args)
+		}
+	}
+}
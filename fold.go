@@ -0,0 +1,108 @@
+package goloc
+
+import (
+	"errors"
+	"go/ast"
+	"go/constant"
+	"go/token"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// foldText returns the text of expr for extraction. String literals and constants are folded the way go/types
+// evaluates them; any other operand of a + concatenation becomes a %s directive, with the operand returned in args.
+// When escape is set, percent signs in the constant parts are escaped, so that the text is always a valid format
+// string. Expressions without any constant part aren't extracted.
+func foldText(info *types.Info, expr ast.Expr, escape bool) (text string, args []ast.Expr, ok bool) {
+	text, args, hasConst := fold(info, expr, escape)
+	if !hasConst || len(args) > 0 && !isConcat(expr) {
+		return "", nil, false
+	}
+	return text, args, true
+}
+
+// extractText returns the text of expr to extract, with its format arguments and whether it's a format string. Texts
+// of format calls keep fmtArgs; concatenated values of other calls become the format arguments instead. ok is false
+// if expr holds no text.
+func extractText(info *types.Info, expr ast.Expr, fmtCall bool, fmtArgs []ast.Expr) (data string, args []ast.Expr, isFmt bool, ok bool, err error) {
+	text, concatArgs, ok := foldText(info, expr, false)
+	if !ok {
+		return "", nil, false, false, nil
+	}
+	if len(concatArgs) == 0 {
+		return text, fmtArgs, fmtCall, true, nil
+	}
+	if fmtCall {
+		// only the %s directives of the concatenated values may use arguments
+		if len(fmtArgs) > 0 || strings.Count(strings.ReplaceAll(text, "%%", ""), "%") != len(concatArgs) {
+			return "", nil, false, true, errors.New("can't combine concatenated values with format directives")
+		}
+		return text, concatArgs, true, true, nil
+	}
+	// the text becomes a format string, so its constant parts need escaping
+	text, _, _ = foldText(info, expr, true)
+	return text, concatArgs, true, true, nil
+}
+
+func fold(info *types.Info, expr ast.Expr, escape bool) (string, []ast.Expr, bool) {
+	if s, ok := constString(info, expr); ok {
+		if escape {
+			s = strings.ReplaceAll(s, "%", "%%")
+		}
+		return s, nil, true
+	}
+	if bin, ok := unparen(expr).(*ast.BinaryExpr); ok && bin.Op == token.ADD && isStringExpr(info, bin) {
+		x, xArgs, xConst := fold(info, bin.X, escape)
+		y, yArgs, yConst := fold(info, bin.Y, escape)
+		return x + y, append(xArgs, yArgs...), xConst || yConst
+	}
+	return "%s", []ast.Expr{expr}, false
+}
+
+// constString returns the value of expr if it's a string constant. Without type information, only literals are
+// understood.
+func constString(info *types.Info, expr ast.Expr) (string, bool) {
+	if info != nil {
+		if tv, ok := info.Types[expr]; ok && tv.Value != nil {
+			if tv.Value.Kind() != constant.String {
+				return "", false
+			}
+			return constant.StringVal(tv.Value), true
+		}
+	}
+	if lit, ok := unparen(expr).(*ast.BasicLit); ok && lit.Kind == token.STRING {
+		s, err := strconv.Unquote(lit.Value)
+		return s, err == nil
+	}
+	return "", false
+}
+
+// isStringExpr reports whether expr is a string. Without type information, any + expression is assumed to be one;
+// it only gets extracted if part of it is a string constant anyway.
+func isStringExpr(info *types.Info, expr ast.Expr) bool {
+	if info == nil {
+		return true
+	}
+	t := info.TypeOf(expr)
+	if t == nil {
+		return true
+	}
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && b.Info()&types.IsString != 0
+}
+
+func isConcat(expr ast.Expr) bool {
+	bin, ok := unparen(expr).(*ast.BinaryExpr)
+	return ok && bin.Op == token.ADD
+}
+
+func unparen(expr ast.Expr) ast.Expr {
+	for {
+		p, ok := expr.(*ast.ParenExpr)
+		if !ok {
+			return expr
+		}
+		expr = p.X
+	}
+}
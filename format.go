@@ -0,0 +1,195 @@
+package goloc
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	textmsg "golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+var printers sync.Map // lang:*textmsg.Printer
+
+func langPrinter(lang string) *textmsg.Printer {
+	if p, ok := printers.Load(lang); ok {
+		return p.(*textmsg.Printer)
+	}
+	p := textmsg.NewPrinter(language.Make(lang))
+	printers.Store(lang, p)
+	return p
+}
+
+// formatArg formats a single argument for lang. typ and style are the MessageFormat argument type and style, such as
+// "number", "currency" with an ISO code, "date" with short/medium/long/full, or "percent". Untyped numbers and dates
+// are still formatted for the language.
+func formatArg(lang string, typ string, style string, v interface{}) string {
+	switch typ {
+	case "number":
+		n, ok := toNumber(v)
+		if !ok {
+			break
+		}
+		switch style {
+		case "integer":
+			return langPrinter(lang).Sprint(number.Decimal(n, number.MaxFractionDigits(0)))
+		case "percent":
+			return langPrinter(lang).Sprint(number.Percent(n))
+		}
+		return langPrinter(lang).Sprint(number.Decimal(n))
+	case "percent":
+		if n, ok := toNumber(v); ok {
+			return langPrinter(lang).Sprint(number.Percent(n))
+		}
+	case "currency":
+		return formatCurrency(lang, style, v)
+	case "date", "time":
+		if t, ok := toTime(v); ok {
+			return formatTime(lang, typ, style, t)
+		}
+	}
+
+	switch x := v.(type) {
+	case string:
+		return x
+	case time.Time, *time.Time:
+		t, _ := toTime(x)
+		return formatTime(lang, "date", "medium", t)
+	case error: // before Stringer, like fmt
+		return x.Error()
+	case fmt.Stringer:
+		return x.String()
+	}
+	if n, ok := toNumber(v); ok {
+		return langPrinter(lang).Sprint(number.Decimal(n))
+	}
+	return fmt.Sprint(v)
+}
+
+// toNumber returns v as a number which x/text/number can format. Strings are parsed.
+func toNumber(v interface{}) (interface{}, bool) {
+	switch x := v.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return x, true
+	case string:
+		if i, err := strconv.ParseInt(x, 10, 64); err == nil {
+			return i, true
+		}
+		if f, err := strconv.ParseFloat(x, 64); err == nil {
+			return f, true
+		}
+	}
+	return nil, false
+}
+
+// numberString returns v in plain decimal notation, as used to pick plural forms.
+func numberString(v interface{}) (string, bool) {
+	switch x := v.(type) {
+	case string:
+		if _, ok := toNumber(x); ok {
+			return x, true
+		}
+		return x, false
+	case float32:
+		return strconv.FormatFloat(float64(x), 'f', -1, 32), true
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64), true
+	}
+	if _, ok := toNumber(v); ok {
+		return fmt.Sprint(v), true
+	}
+	return fmt.Sprint(v), false
+}
+
+func toTime(v interface{}) (time.Time, bool) {
+	switch x := v.(type) {
+	case time.Time:
+		return x, true
+	case *time.Time:
+		if x != nil {
+			return *x, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// currencyAfter lists the languages which put the currency symbol after the amount.
+var currencyAfter = map[string]bool{
+	"de": true, "fr": true, "es": true, "it": true, "pl": true, "ru": true, "uk": true, "cs": true, "sk": true,
+	"sv": true, "fi": true, "da": true, "nb": true, "pt-PT": true, "vi": true,
+}
+
+// formatCurrency formats v as an amount of the ISO currency code.
+func formatCurrency(lang string, code string, v interface{}) string {
+	unit, err := currency.ParseISO(code)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	n, ok := toNumber(v)
+	if !ok {
+		return fmt.Sprint(v)
+	}
+
+	p := langPrinter(lang)
+	scale, _ := currency.Standard.Rounding(unit)
+	amount := p.Sprint(number.Decimal(n, number.Scale(scale)))
+	symbol := p.Sprint(currency.Symbol(unit))
+
+	tag := language.Make(lang)
+	base, _ := tag.Base()
+	if after, ok := currencyAfter[tag.String()]; ok && after || !ok && currencyAfter[base.String()] {
+		return amount + " " + symbol
+	}
+	return symbol + amount
+}
+
+// dateLayouts holds the short, medium, long and full date layouts, then the short and medium time layouts for each
+// language. x/text has no date formatting, so this only covers common languages; others use ISO 8601. Month and day
+// names are only available in English.
+var dateLayouts = map[string][6]string{
+	"en":    {"02/01/2006", "2 Jan 2006", "2 January 2006", "Monday, 2 January 2006", "15:04", "15:04:05"},
+	"en-US": {"1/2/06", "Jan 2, 2006", "January 2, 2006", "Monday, January 2, 2006", "3:04 PM", "3:04:05 PM"},
+	"de":    {"02.01.06", "02.01.2006", "02.01.2006", "02.01.2006", "15:04", "15:04:05"},
+	"fr":    {"02/01/2006", "02/01/2006", "02/01/2006", "02/01/2006", "15:04", "15:04:05"},
+	"es":    {"2/1/06", "02/01/2006", "02/01/2006", "02/01/2006", "15:04", "15:04:05"},
+	"it":    {"02/01/06", "02/01/2006", "02/01/2006", "02/01/2006", "15:04", "15:04:05"},
+	"pt":    {"02/01/2006", "02/01/2006", "02/01/2006", "02/01/2006", "15:04", "15:04:05"},
+	"nl":    {"02-01-2006", "02-01-2006", "02-01-2006", "02-01-2006", "15:04", "15:04:05"},
+	"ru":    {"02.01.2006", "02.01.2006", "02.01.2006", "02.01.2006", "15:04", "15:04:05"},
+	"pl":    {"02.01.2006", "02.01.2006", "02.01.2006", "02.01.2006", "15:04", "15:04:05"},
+	"tr":    {"02.01.2006", "02.01.2006", "02.01.2006", "02.01.2006", "15:04", "15:04:05"},
+	"ja":    {"2006/01/02", "2006/01/02", "2006/01/02", "2006/01/02", "15:04", "15:04:05"},
+	"zh":    {"2006/1/2", "2006/01/02", "2006/01/02", "2006/01/02", "15:04", "15:04:05"},
+	"ko":    {"06. 1. 2.", "2006. 1. 2.", "2006. 1. 2.", "2006. 1. 2.", "15:04", "15:04:05"},
+}
+
+var isoLayouts = [6]string{"2006-01-02", "2006-01-02", "2006-01-02", "2006-01-02", "15:04", "15:04:05"}
+
+var dateStyles = map[string]int{"short": 0, "": 1, "medium": 1, "long": 2, "full": 3}
+
+// formatTime formats t as a date or time in the given style. Unknown styles are used as Go time layouts.
+func formatTime(lang string, typ string, style string, t time.Time) string {
+	tag := language.Make(lang)
+	layouts, ok := dateLayouts[tag.String()]
+	if !ok {
+		base, _ := tag.Base()
+		if layouts, ok = dateLayouts[base.String()]; !ok {
+			layouts = isoLayouts
+		}
+	}
+
+	i, ok := dateStyles[style]
+	if !ok {
+		return t.Format(style)
+	}
+	if typ == "time" {
+		if i > 1 {
+			i = 1
+		}
+		return t.Format(layouts[4+i])
+	}
+	return t.Format(layouts[i])
+}
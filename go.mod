@@ -1,11 +1,21 @@
 module github.com/PaulSonOfLars/goloc
 
-go 1.14
+go 1.26.0
 
 require (
 	github.com/BlackEspresso/htmlcheck v0.0.0-20160509055325-689a0dd0f92a
 	github.com/spf13/cobra v0.0.6
 	go.uber.org/zap v1.14.1
-	golang.org/x/text v0.3.2
-	golang.org/x/tools v0.0.0-20200321224714-0d839f3cf2ed
+	golang.org/x/text v0.42.0
+	golang.org/x/tools v0.50.0
+)
+
+require (
+	github.com/inconshreveable/mousetrap v1.0.0 // indirect
+	github.com/spf13/pflag v1.0.3 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
+	golang.org/x/mod v0.41.0 // indirect
+	golang.org/x/net v0.59.0 // indirect
+	golang.org/x/sync v0.23.0 // indirect
 )
@@ -21,6 +21,7 @@ func main() {
 	}
 
 	var lang string
+	keys := string(goloc.KeyCounter)
 	verbose := false
 
 	dyn := zap.NewAtomicLevel() // defaults to Info
@@ -46,14 +47,28 @@ func main() {
 				dyn.SetLevel(zap.InfoLevel)
 			}
 			l.DefaultLang = lang
+			l.Keys = goloc.KeyStrategy(keys)
 		},
 	}
 
-	rootCmd.PersistentFlags().StringSliceVar(&l.Funcs, "funcs", nil, "all funcs to extraxt")
-	rootCmd.PersistentFlags().StringSliceVar(&l.Fmtfuncs, "fmtfuncs", nil, "all format funcs to extract")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Funcs, "funcs", nil, "funcs to extract, such as fmt.Println or (*tgbotapi.BotAPI).Send; bare names match any call of that name. Append :n to take the text from argument n")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Fmtfuncs, "fmtfuncs", nil, "format funcs to extract, such as fmt.Printf; append :n:m to take the text from argument n and the format args from argument m on")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Formatters, "formatters", goloc.DefaultFormatters, "calls, such as fmt.Sprintf, which are replaced as a whole when passed as the text of an extracted func")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Fields, "fields", nil, "struct fields to extract from composite literals, such as cobra.Command.Short")
+	rootCmd.PersistentFlags().BoolVar(&l.Variadic, "variadic", false, "generate Trnlfv calls instead of Trnlf with a map. Arguments are passed as they are and formatted for the language, so %d numbers are grouped, such as 2,024")
+	rootCmd.PersistentFlags().BoolVar(&l.LocaleNumbers, "locale-numbers", false, "give %d integers {n, number, integer} placeholders, so they're formatted for the language, such as 2,024 rather than 2024, in Trnlf maps too")
+	rootCmd.PersistentFlags().BoolVar(&l.Context, "context", false, "generate T/Tf calls which read the language from a context.Context in scope. Functions without one get a lang variable instead")
+	rootCmd.PersistentFlags().StringVar(&l.LangExpr, "lang-expr", goloc.DefaultLangExpr, "expression assigned to the lang variable injected into functions")
+	rootCmd.PersistentFlags().StringVar(&keys, "keys", string(goloc.KeyCounter), "how to build the keys of new strings: counter, hash, slug or func. A //goloc:key comment on or above a string sets its key explicitly")
+	rootCmd.PersistentFlags().BoolVar(&l.FuncContext, "func-context", false, "use the enclosing function as the context of strings without a //goloc:context comment, so identical strings in different functions are translated separately")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Exclude, "exclude", nil, "globs of files or directories to skip, such as internal/gen or *_string.go")
+	rootCmd.PersistentFlags().StringSliceVar(&l.Tags, "tags", nil, "build tags to use when loading packages")
+	rootCmd.PersistentFlags().BoolVar(&l.Tests, "tests", false, "also handle _test.go files")
+	rootCmd.PersistentFlags().BoolVar(&l.Generated, "generated", false, "also handle generated files")
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "add extra verbosity")
 	rootCmd.PersistentFlags().BoolVarP(&l.Apply, "apply", "a", false, "save to file")
 	rootCmd.PersistentFlags().StringVarP(&lang, "lang", "l", language.BritishEnglish.String(), "")
+	rootCmd.PersistentFlags().StringVar(&l.Dir, "dir", goloc.TranslationDir, "directory holding the translation files")
 
 	rootCmd.AddCommand(&cobra.Command{
 		Use:   "inspect",
@@ -75,6 +90,55 @@ func main() {
 		},
 	})
 
+	rekeyMap := ""
+	rekeyCmd := &cobra.Command{
+		Use:   "rekey [packages]",
+		Short: "rename translation keys in the source and the translations of every language",
+		Long: "Rename translation keys, either as listed in a mapping file or by building them again with the --keys strategy. " +
+			"The goloc calls of the given packages (./... by default) and the translation files of every language are updated together. " +
+			"The renamed keys are printed, in the format of mapping files.",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(args) == 0 {
+				args = []string{"./..."}
+			}
+			if rekeyMap == "" {
+				if !cmd.Flag("keys").Changed {
+					s.Fatal("select the new keys with --map or --keys")
+				}
+				if err := l.RekeyAll(args, l.Keys); err != nil {
+					s.Fatal(err)
+				}
+				return
+			}
+			f, err := os.Open(rekeyMap)
+			if err != nil {
+				s.Fatal(err)
+			}
+			mapping, err := goloc.ParseKeyMapping(f)
+			f.Close()
+			if err != nil {
+				s.Fatalf("invalid mapping file %s: %s", rekeyMap, err.Error())
+			}
+			if err := l.Rekey(args, mapping); err != nil {
+				s.Fatal(err)
+			}
+		},
+	}
+	rekeyCmd.Flags().StringVarP(&rekeyMap, "map", "m", "", "file listing an old key and its new key on each line")
+	rootCmd.AddCommand(rekeyCmd)
+
+	rootCmd.AddCommand(&cobra.Command{
+		Use:   "mv old.go new.go [packages]",
+		Short: "move a go file along with its translations",
+		Long:  "Move a go file, renaming its translation files and the keys built from its name. Keys are also renamed in the given packages.",
+		Args:  cobra.MinimumNArgs(2),
+		Run: func(cmd *cobra.Command, args []string) {
+			if err := l.Move(args[2:], args[0], args[1]); err != nil {
+				s.Fatal(err)
+			}
+		},
+	})
+
 	createLang := ""
 	createCmd := &cobra.Command{
 		Use:   "create",
@@ -0,0 +1,250 @@
+package goloc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"go/types"
+	"hash/fnv"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// KeyStrategy decides how the keys of newly extracted strings are built.
+type KeyStrategy string
+
+const (
+	KeyCounter KeyStrategy = "counter" // file:n, numbered in the order strings are extracted
+	KeyHash    KeyStrategy = "hash"    // a hash of the text and its context
+	KeySlug    KeyStrategy = "slug"    // the words of the text, such as hello_world
+	KeyFunc    KeyStrategy = "func"    // the package-qualified enclosing function, numbered within it
+)
+
+// KeyStrategies are all the supported key strategies.
+var KeyStrategies = []KeyStrategy{KeyCounter, KeyHash, KeySlug, KeyFunc}
+
+// Directives are comments which set something about the string extracted from the same line, or from the line after
+// their comment block.
+const (
+	keyDirective     = "//goloc:key "     // an explicit key, such as //goloc:key welcome_msg
+	contextDirective = "//goloc:context " // a context, such as //goloc:context verb
+)
+
+// maxSlug is the maximum number of runes in a slug key.
+const maxSlug = 40
+
+func (l *Locer) keyStrategy() KeyStrategy {
+	if l.Keys == "" {
+		return KeyCounter
+	}
+	return l.Keys
+}
+
+// checkKeys ensures that Keys is a known strategy.
+func (l *Locer) checkKeys() error {
+	for _, k := range KeyStrategies {
+		if l.keyStrategy() == k {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown key strategy %q: expected one of %s", l.Keys, joinKeyStrategies(", "))
+}
+
+func joinKeyStrategies(sep string) string {
+	names := make([]string, len(KeyStrategies))
+	for i, k := range KeyStrategies {
+		names[i] = string(k)
+	}
+	return strings.Join(names, sep)
+}
+
+// keyHint is what keys can be built from, besides the text itself, along with what translators are told about it.
+type keyHint struct {
+	fn       string // package-qualified name of the enclosing function
+	context  string // context telling apart identical texts with different meanings
+	explicit string // key given by a //goloc:key comment
+	note     string // comment for translators
+	ref      SourceRef
+}
+
+// newKey returns the key of a new text in module, which got n from the module counter. Keys given explicitly are used
+// as long as no other text has them. Keys built from the text are shared by identical texts in the same context, and
+// numbered when different texts would get the same key.
+func (l *Locer) newKey(module string, n int, text string, hint keyHint) string {
+	id := dedupKey(text, hint.context)
+	if hint.explicit != "" {
+		if l.keyFree(hint.explicit, id) {
+			return hint.explicit
+		}
+		Logger.Warnf("key %q is already used by another string; using the %s strategy instead", hint.explicit, l.keyStrategy())
+	}
+
+	switch l.keyStrategy() {
+	case KeyHash:
+		return hashKey(text, hint.context)
+	case KeySlug:
+		s := slug(text)
+		if s == "" {
+			return hashKey(text, hint.context)
+		}
+		return l.freeKey(id, func(i int) string {
+			if i == 1 {
+				return s
+			}
+			return s + "_" + strconv.Itoa(i)
+		})
+	case KeyFunc:
+		if hint.fn != "" {
+			return l.freeKey(id, func(i int) string {
+				return hint.fn + ":" + strconv.Itoa(i)
+			})
+		}
+	}
+	return module + ":" + strconv.Itoa(n)
+}
+
+// freeKey returns the first of key(1), key(2)... which isn't used by another text; id is the dedupKey of the text.
+func (l *Locer) freeKey(id string, key func(i int) string) string {
+	for i := 1; ; i++ {
+		if k := key(i); l.keyFree(k, id) {
+			return k
+		}
+	}
+}
+
+// keyFree reports whether key is unused, or already used by the text with the dedupKey id. All the translations of the
+// default language are loaded the first time, so that keys stay unique across modules.
+func (l *Locer) keyFree(key string, id string) bool {
+	if !l.allLoaded {
+		if err := l.catalog().LoadLangAllE(l.DefaultLang); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			Logger.Warn(err)
+		}
+		l.allLoaded = true
+	}
+	if used, ok := l.usedKeys[key]; ok {
+		return used == id
+	}
+	v, ok := l.catalog().get(l.DefaultLang, key)
+	return !ok || dedupKey(rowText(v), v.Context) == id
+}
+
+// useKey records that key was handed out to the text with the dedupKey id.
+func (l *Locer) useKey(key string, id string) {
+	if l.usedKeys == nil {
+		l.usedKeys = make(map[string]string)
+	}
+	l.usedKeys[key] = id
+}
+
+// dedupKey identifies text in its context: identical texts are only shared by strings with the same context.
+func dedupKey(text string, context string) string {
+	if context == "" {
+		return text
+	}
+	// separated like gettext does for message contexts
+	return context + "\x04" + text
+}
+
+// hashKey returns a hash of text and its context, which is the same wherever the text is.
+func hashKey(text string, context string) string {
+	h := fnv.New64a()
+	h.Write([]byte(dedupKey(text, context)))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// slug returns the letters and digits of text in lower case, with every run of anything else replaced by a single
+// underscore. Placeholders are left out, and the slug is cut at maxSlug runes.
+func slug(text string) string {
+	var b strings.Builder
+	var n, depth int
+	gap := false
+	for _, r := range text {
+		switch {
+		case r == '{':
+			depth++
+			gap = true
+			continue
+		case r == '}' && depth > 0:
+			depth--
+			continue
+		case depth > 0:
+			continue
+		case !unicode.IsLetter(r) && !unicode.IsDigit(r):
+			gap = true
+			continue
+		}
+		if n == maxSlug {
+			break
+		}
+		if gap && n > 0 {
+			b.WriteRune('_')
+			n++
+		}
+		gap = false
+		b.WriteRune(unicode.ToLower(r))
+		n++
+	}
+	return strings.TrimSuffix(b.String(), "_")
+}
+
+// funcKeyName returns the package-qualified name of the function declared by decl, such as
+// (*example.com/bot.Bot).Start.
+func funcKeyName(info *types.Info, pkgPath string, decl *ast.FuncDecl) string {
+	if info != nil {
+		if fn, ok := info.Defs[decl.Name].(*types.Func); ok {
+			return fn.FullName()
+		}
+	}
+	return pkgPath + "." + decl.Name.Name
+}
+
+// directive is the value of a //goloc: comment.
+type directive struct {
+	value string
+	used  bool
+}
+
+// directives returns the values of the comments in f starting with prefix, by the lines they apply to.
+func (l *Locer) directives(f *ast.File, prefix string) map[int]*directive {
+	out := make(map[int]*directive)
+	for _, group := range f.Comments {
+		next := l.Fset.Position(group.End()).Line + 1
+		for _, c := range group.List {
+			if v, ok := strings.CutPrefix(c.Text, prefix); ok && strings.TrimSpace(v) != "" {
+				d := &directive{value: strings.TrimSpace(v)}
+				out[l.Fset.Position(c.Pos()).Line] = d
+				out[next] = d
+			}
+		}
+	}
+	return out
+}
+
+// directiveAt returns the value of the directive applying to the string at pos. Each directive is only used once.
+func (l *Locer) directiveAt(ds map[int]*directive, pos token.Pos) string {
+	d, ok := ds[l.Fset.Position(pos).Line]
+	if !ok || d.used {
+		return ""
+	}
+	d.used = true
+	return d.value
+}
+
+// moduleRoot returns the directory of the go.mod file governing dir, or an empty string if there is none.
+func moduleRoot(dir string) string {
+	for {
+		if fi, err := os.Stat(filepath.Join(dir, "go.mod")); err == nil && fi.Mode().IsRegular() {
+			return dir
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
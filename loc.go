@@ -7,9 +7,9 @@ import (
 	"fmt"
 	"go/ast"
 	"go/format"
-	"go/parser"
 	"go/printer"
 	"go/token"
+	"go/types"
 	"os"
 	"path"
 	"path/filepath"
@@ -20,10 +20,9 @@ import (
 	"github.com/BlackEspresso/htmlcheck"
 	"golang.org/x/text/language"
 	"golang.org/x/tools/go/ast/astutil"
+	"golang.org/x/tools/go/packages"
 )
 
-const translationDir = "trans"
-
 type Translation struct {
 	XMLName xml.Name `xml:"translation"`
 	Rows    []Value
@@ -31,66 +30,136 @@ type Translation struct {
 }
 
 type Value struct {
-	Id      int    `xml:"id,attr"`
-	Name    string `xml:"name,attr"`
-	Value   string `xml:"value"`
-	Comment string `xml:",comment"`
+	Id      int         `xml:"id,attr"`
+	Name    string      `xml:"name,attr"`
+	Context string      `xml:"context,attr,omitempty"` // tells apart identical texts with different meanings
+	Value   string      `xml:"value"`
+	Plurals []Plural    `xml:"plural"`
+	Note    string      `xml:"note,omitempty"`       // explanation for translators, from a TRANSLATORS: comment
+	Refs    []SourceRef `xml:"source-ref,omitempty"` // where the string is used
+	Comment string      `xml:",comment"`
+
+	tmpl *template // parsed Value, set when loaded
+}
+
+// compile parses the value and all plural forms, so they can be formatted without parsing them again.
+func (v *Value) compile() {
+	v.tmpl = newTemplate(v.Value)
+	for i := range v.Plurals {
+		v.Plurals[i].tmpl = newTemplate(v.Plurals[i].Value)
+	}
+}
+
+// template returns the parsed value, parsing it if it wasn't loaded by a bundle.
+func (v Value) template() *template {
+	if v.tmpl != nil {
+		return v.tmpl
+	}
+	return newTemplate(v.Value)
 }
 
 type Locer struct {
-	DefaultLang string
-	Funcs       []string
-	Fmtfuncs    []string
-	Checked     map[string]struct{}
-	OrderedVals []string
-	Fset        *token.FileSet
-	Apply       bool
+	DefaultLang   string
+	Funcs         []string
+	Fmtfuncs      []string
+	Fields        []string // struct fields to extract from composite literals, such as cobra.Command.Short
+	Formatters    []string // calls, such as fmt.Sprintf, which are replaced as a whole when passed as text; defaults to DefaultFormatters
+	Exclude       []string // globs of files or directories to leave alone, such as internal/gen or *_string.go
+	Tags          []string // build tags used when loading packages
+	Tests         bool     // also handle _test.go files
+	Generated     bool     // also handle generated files
+	Checked       map[string]struct{}
+	OrderedVals   []string
+	Fset          *token.FileSet
+	Apply         bool
+	Dir           string      // translation directory; defaults to TranslationDir
+	Variadic      bool        // generate Trnlfv calls rather than Trnlf calls with a map of strings
+	LocaleNumbers bool        // give %d integers {n, number, integer} placeholders, formatting them for the locale
+	Context       bool        // generate T, Tf and Tfv calls which take the language from a context in scope, if any
+	LangExpr      string      // expression assigned to injected lang variables; defaults to DefaultLangExpr
+	Keys          KeyStrategy // how the keys of new strings are built; defaults to KeyCounter
+	FuncContext   bool        // use the enclosing function as the context of strings which aren't given one
+
+	bundle    *Bundle           // translations loaded while extracting and checking
+	allLoaded bool              // all the default language translations are in bundle
+	usedKeys  map[string]string // texts of the keys handed out while extracting, by key
 }
 
-func (l *Locer) Handle(args []string, hdnl func(*ast.File)) error {
+// catalog returns the bundle holding all translations loaded by the Locer.
+func (l *Locer) catalog() *Bundle {
+	if l.bundle == nil {
+		l.bundle = NewBundle(l.DefaultLang)
+		l.bundle.Dir = l.dir()
+	}
+	return l.bundle
+}
+
+func (l *Locer) dir() string {
+	if l.Dir != "" {
+		return l.Dir
+	}
+	return TranslationDir
+}
+
+// Handle loads the packages matching args with their type information, and passes each of their files to hdnl. Args
+// can be files, directories or package patterns such as ./...; when files are given, the other files of their packages
+// are left alone. Tests, vendored and generated files, testdata and anything matching Exclude are skipped.
+func (l *Locer) Handle(args []string, hdnl func(*ast.File, *packages.Package)) error {
 	if len(args) == 0 {
 		Logger.Error("No input provided.")
 		return nil
 	}
+	if err := l.checkSpecs(); err != nil {
+		return err
+	}
+	if err := l.checkExclude(); err != nil {
+		return err
+	}
+	if err := l.checkKeys(); err != nil {
+		return err
+	}
+	var patterns, filePatterns []string
+	files := make(map[string]bool) // files given explicitly
 	for _, arg := range args {
 		fi, err := os.Stat(arg)
-		if err != nil {
-			return err
-		}
-
-		switch mode := fi.Mode(); {
-		case mode.IsDir():
-			// do directory stuff
-			Logger.Debug("directory input")
-			nodes, err := parser.ParseDir(l.Fset, arg, nil, parser.ParseComments)
+		switch {
+		case err == nil && fi.Mode().IsRegular():
+			Logger.Debug("file input")
+			abs, err := filepath.Abs(arg)
 			if err != nil {
 				return err
 			}
-			for _, n := range nodes {
-				for _, f := range n.Files {
-					name := l.Fset.File(f.Pos()).Name()
-					if _, ok := l.Checked[name]; ok {
-						continue // todo: check for file name clashes in diff packages?
-					}
-					l.Checked[name] = struct{}{}
-					hdnl(f)
-				}
-			}
-		case mode.IsRegular():
-			// do file stuff
-			Logger.Debug("file input")
-			node, err := parser.ParseFile(l.Fset, arg, nil, parser.ParseComments)
+			filePatterns = append(filePatterns, "file="+abs)
+			files[abs] = true
+		case err == nil && fi.IsDir():
+			Logger.Debug("directory input")
+			abs, err := filepath.Abs(arg)
 			if err != nil {
 				return err
 			}
-			name := l.Fset.File(node.Pos()).Name()
-			if _, ok := l.Checked[name]; ok {
-				continue // todo: check for file name clashes in diff packages?
-			}
-			l.Checked[name] = struct{}{}
-			hdnl(node)
+			patterns = append(patterns, abs)
+		case strings.HasSuffix(arg, ".go"):
+			return err
+		default:
+			Logger.Debug("package pattern input")
+			patterns = append(patterns, arg)
 		}
 	}
+
+	if len(patterns) > 0 {
+		pkgs, err := l.load(patterns)
+		if err != nil {
+			return err
+		}
+		l.handlePackages(pkgs, nil, hdnl)
+	}
+	if len(filePatterns) > 0 {
+		pkgs, err := l.load(filePatterns)
+		if err != nil {
+			return err
+		}
+		l.handlePackages(pkgs, files, hdnl)
+	}
 	Logger.Info("the following have been checked:")
 	for k := range l.Checked {
 		Logger.Info("  " + k)
@@ -98,8 +167,60 @@ func (l *Locer) Handle(args []string, hdnl func(*ast.File)) error {
 	return nil
 }
 
+// handlePackages passes the files of pkgs to hdnl, skipping files which were already handled or shouldn't be
+// changed. If only is set, other files are skipped too.
+func (l *Locer) handlePackages(pkgs []*packages.Package, only map[string]bool, hdnl func(*ast.File, *packages.Package)) {
+	for _, pkg := range pkgs {
+		for _, err := range pkg.Errors {
+			// type errors are common, for example when getLang is only declared once extracted; carry on regardless.
+			Logger.Debugf("%s: %s", pkg.PkgPath, err.Error())
+		}
+		if strings.HasSuffix(pkg.PkgPath, ".test") {
+			continue // generated main package of a test binary
+		}
+		for _, f := range pkg.Syntax {
+			fpath := l.Fset.File(f.Pos()).Name()
+			if only != nil && !only[fpath] {
+				continue
+			}
+			name := l.fileName(f.Pos())
+			if _, ok := l.Checked[name]; ok {
+				continue
+			}
+			if reason := l.skipFile(name, f); reason != "" {
+				Logger.Debugf("skipping %s: %s", name, reason)
+				continue
+			}
+			l.Checked[name] = struct{}{}
+			hdnl(f, pkg)
+		}
+	}
+}
+
+// fileName returns the module name of the file holding pos.
+func (l *Locer) fileName(pos token.Pos) string {
+	return moduleName(l.Fset.File(pos).Name())
+}
+
+// moduleName returns the name of the file at the absolute path name, relative to the root of its module, however the
+// file was given. Files outside modules are named relative to the working directory instead, if they're inside it. The
+// name is used in translation keys and Load calls, so it has to stay stable between runs.
+func moduleName(name string) string {
+	if root := moduleRoot(filepath.Dir(name)); root != "" {
+		if rel, err := filepath.Rel(root, name); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	if wd, err := os.Getwd(); err == nil {
+		if rel, err := filepath.Rel(wd, name); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return name
+}
+
 // TODO: remove dup code with the fix() method
-func (l *Locer) Inspect(node *ast.File) {
+func (l *Locer) Inspect(node *ast.File, pkg *packages.Package) {
 	var counter int
 	// var inMeth *ast.FuncDecl
 	ast.Inspect(node, func(n ast.Node) bool {
@@ -107,29 +228,37 @@ func (l *Locer) Inspect(node *ast.File) {
 		//	inMeth = ret
 		//
 		// } else
-		if ret, ok := n.(*ast.CallExpr); ok {
+		if lit, ok := n.(*ast.CompositeLit); ok {
+			for _, elt := range lit.Elts {
+				if kv, ok := elt.(*ast.KeyValueExpr); ok {
+					v, ok := l.fieldText(pkg.TypesInfo, lit, kv)
+					if _, _, isText := foldText(pkg.TypesInfo, v, false); ok && isText {
+						Logger.Debugf("\n   found a field string at %s", l.Fset.Position(v.Pos()))
+						counter++
+						l.OrderedVals = append(l.OrderedVals, l.fileName(v.Pos())+":"+strconv.Itoa(counter))
+					}
+				}
+			}
+		} else if ret, ok := n.(*ast.CallExpr); ok {
 			Logger.Debug("\n found a call ")
 			// printer.Fprint(os.Stdout, fset, ret)
-			if f, ok := ret.Fun.(*ast.SelectorExpr); ok {
-				Logger.Debug("\n  found call named " + f.Sel.Name)
-				if contains(append(l.Funcs, l.Fmtfuncs...), f.Sel.Name) && len(ret.Args) > 0 {
-					ex := ret.Args[0]
+			if spec, _, ok := l.matchCall(pkg.TypesInfo, ret); ok {
+				Logger.Debug("\n  found call to " + spec.name)
+				if len(ret.Args) > spec.text {
+					ex := ret.Args[spec.text]
+					if text, _, _, ok, _ := l.unwrapFormatter(pkg.TypesInfo, ex); ok {
+						ex = text
+					}
 
-					if v, ok := ex.(*ast.BasicLit); ok && v.Kind == token.STRING {
+					if _, _, ok := foldText(pkg.TypesInfo, ex, false); ok {
 						buf := bytes.NewBuffer([]byte{})
-						printer.Fprint(buf, l.Fset, v)
+						printer.Fprint(buf, l.Fset, ex)
 						Logger.Debugf("\n   found a string:\n%s", buf.String())
 
 						counter++
-						name := l.Fset.File(v.Pos()).Name() + ":" + strconv.Itoa(counter)
+						name := l.fileName(ex.Pos()) + ":" + strconv.Itoa(counter)
 						l.OrderedVals = append(l.OrderedVals, name)
 
-					} else if v2, ok := ex.(*ast.BinaryExpr); ok && v2.Op == token.ADD {
-						// note: plz reformat not to use adds
-						Logger.Debug("\n   found a binary expr instead of str; fix your code")
-						// v, ok := v2.X.(*ast.BasicLit)
-						// v, ok := v2.Y.(*ast.BasicLit)
-
 					} else {
 						Logger.Debugf("\n   found something else: %T", ex)
 
@@ -147,8 +276,8 @@ var newDataNames map[string][]string               // filename:[]newtriggers
 var noDupStrings map[string]string                 // map of currently loaded strings, to avoid duplicates and reduce translation efforts
 
 // todo: ensure import works as expected
-func (l *Locer) Fix(node *ast.File) {
-	name := l.Fset.File(node.Pos()).Name()
+func (l *Locer) Fix(node *ast.File, pkg *packages.Package) {
+	name := l.fileName(node.Pos())
 	loadModuleExpr := &ast.ExprStmt{
 		X: &ast.CallExpr{
 			Fun: &ast.SelectorExpr{
@@ -164,10 +293,14 @@ func (l *Locer) Fix(node *ast.File) {
 		},
 	}
 
-	// todo: investigate unnecessary "lang := " loads
+	langExpr, err := l.langExpr()
+	if err != nil {
+		Logger.Fatal(err)
+		return
+	}
 
-	Load(name) // load current values
-	Logger.Debug("module count at", dataCount[name])
+	l.catalog().Load(name) // load current values
+	Logger.Debug("module count at", l.catalog().count(name))
 	newData = make(map[string]map[string]map[string]Value) // locale:(filename:(trigger:Value))
 	newDataNames = make(map[string][]string)               // filename:[]newtriggers
 	noDupStrings = make(map[string]string)                 // map of currently loaded strings, to avoid duplicates and reduce translation efforts
@@ -176,15 +309,61 @@ func (l *Locer) Fix(node *ast.File) {
 	newData[l.DefaultLang] = make(map[string]map[string]Value)
 	newData[l.DefaultLang][name] = make(map[string]Value)
 	// initialise set for all other languages
-	for k := range data { // initialise all languages
+	for _, k := range l.catalog().Languages() { // initialise all languages
 		newData[k] = make(map[string]map[string]Value)
 		newData[k][name] = make(map[string]Value)
 	}
 
-	var needsLangSetting bool  // method needs the lang := arg
-	var needGolocImport bool   // goloc needs importing
-	var needStrconvImport bool // need to import strconv
-	var initExists bool        // does init method exist
+	var funcs []*ast.FuncType // functions enclosing the current node, innermost last
+	var decl *ast.FuncDecl    // declared function enclosing the current node
+	keyComments := l.directives(node, keyDirective)
+	contextComments := l.directives(node, contextDirective)
+	notes := l.notes(node)
+	bodies := map[*ast.FuncType]*ast.BlockStmt{} // bodies of the functions, to inject lang variables into
+	var langUses []langUse                       // generated calls needing a lang variable
+	var needGolocImport bool                     // goloc needs importing
+	var initExists bool                          // does init method exist
+	needImports := map[string]bool{}             // other packages used by the generated code
+
+	// source picks the language of a translation at pos. Outside functions, there is none to pick.
+	source := func(pos token.Pos) (langSource, bool) {
+		var fn *ast.FuncType
+		if len(funcs) > 0 {
+			fn = funcs[len(funcs)-1]
+		}
+		src := l.langSource(pkg, pos, fn)
+		if src.inject && fn == nil {
+			Logger.Warnf("%s: skipping string outside functions: no language to translate into", l.Fset.Position(pos))
+			return src, false
+		}
+		return src, true
+	}
+
+	// hint returns what the key of a new string at pos can be built from, including its context, and what translators
+	// are told about it.
+	hint := func(pos token.Pos) keyHint {
+		h := keyHint{
+			explicit: l.directiveAt(keyComments, pos),
+			context:  l.directiveAt(contextComments, pos),
+			note:     l.directiveAt(notes, pos),
+		}
+		if decl != nil {
+			h.fn = funcKeyName(pkg.TypesInfo, pkg.PkgPath, decl)
+		}
+		h.ref = SourceRef{Func: h.fn, Pos: name + ":" + strconv.Itoa(l.Fset.Position(pos).Line)}
+		if h.context == "" && l.FuncContext {
+			h.context = h.fn
+		}
+		return h
+	}
+
+	// imports only used by unwrapped calls, such as fmt.Sprintf, have to be removed afterwards
+	var usedImports []string
+	for _, imp := range node.Imports {
+		if fpath, err := strconv.Unquote(imp.Path.Value); err == nil && astutil.UsesImport(node, fpath) {
+			usedImports = append(usedImports, fpath)
+		}
+	}
 
 	// should return to node?
 	astutil.Apply(node,
@@ -196,68 +375,181 @@ func (l *Locer) Fix(node *ast.File) {
 				if ret.Name.Name == "init" {
 					initExists = true
 				}
+				decl = ret
+				funcs = append(funcs, ret.Type)
+				bodies[ret.Type] = ret.Body
+
+			} else if ret, ok := n.(*ast.FuncLit); ok {
+				funcs = append(funcs, ret.Type)
+				bodies[ret.Type] = ret.Body
+
+				// Check struct fields
+			} else if kv, ok := n.(*ast.KeyValueExpr); ok {
+				lit, ok := cursor.Parent().(*ast.CompositeLit)
+				if !ok {
+					return true
+				}
+				v, ok := l.fieldText(pkg.TypesInfo, lit, kv)
+				if !ok {
+					return true
+				}
+				textArg, isFmtText, fmtArgs, wrapErr := v, false, []ast.Expr(nil), false
+				if text, args, isErr, ok, err := l.unwrapFormatter(pkg.TypesInfo, v); err != nil {
+					Logger.Warnf("%s: skipping field: %s", l.Fset.Position(v.Pos()), err.Error())
+					return true
+				} else if ok {
+					textArg, fmtArgs, isFmtText, wrapErr = text, args, true, isErr
+				}
+				if data, fmtArgs, isFmt, ok, err := extractText(pkg.TypesInfo, textArg, isFmtText, fmtArgs); ok {
+					if !inFunc(pkg.Types, kv.Pos()) {
+						Logger.Debugf("\n   skipping field at %s: no language outside functions", l.Fset.Position(kv.Pos()))
+						return true
+					}
+					var call *ast.CallExpr
+					var imports []string
+					src, ok := source(kv.Pos())
+					if !ok {
+						return true
+					}
+					if err == nil {
+						call, imports, err = l.injectTran(pkg.TypesInfo, name, data, fmtArgs, isFmt, src, hint(kv.Pos()))
+					}
+					if err != nil {
+						Logger.Warnf("%s: skipping field: %s", l.Fset.Position(v.Pos()), err.Error())
+						return true
+					}
+					kv.Value = call
+					if wrapErr {
+						kv.Value = pkgCall("errors", "New", call)
+						imports = append(imports, "errors")
+					}
+					placeAt(kv.Value, v.Pos(), v.End())
+					for _, imp := range imports {
+						needImports[imp] = true
+					}
+					needGolocImport = true
+					if src.inject {
+						langUses = append(langUses, newLangUse(funcs, call))
+					}
+					return false
+				}
 
 				// Check method calls
 			} else if callExpr, ok := n.(*ast.CallExpr); ok {
-				// determine if method is one of the validated ones
-				if funcCall, ok := callExpr.Fun.(*ast.SelectorExpr); ok {
-					Logger.Debug("\n  found random call named " + funcCall.Sel.Name)
-
-					// if valid and has args, check first arg (which should be a string)
-					if contains(append(l.Funcs, l.Fmtfuncs...), funcCall.Sel.Name) && len(callExpr.Args) > 0 {
-						firstArg := callExpr.Args[0]
-
-						if litItem, ok := firstArg.(*ast.BasicLit); ok && litItem.Kind == token.STRING {
-							buf := bytes.NewBuffer([]byte{})
-							printer.Fprint(buf, l.Fset, litItem)
-							Logger.Debugf("\n   found a string in funcname %s:\n%s", funcCall.Sel.Name, buf.String())
-
-							args, needStrconvImportNew := l.injectTran(name, callExpr, funcCall, litItem)
-
-							funcCall.Sel.Name = l.getUnFmtFunc(funcCall.Sel.Name)
-							callExpr.Fun = funcCall
-							callExpr.Args = []ast.Expr{args}
-							cursor.Replace(callExpr)
-							needStrconvImport = needStrconvImportNew
-							needGolocImport = true
-							needsLangSetting = true
-							return false
-
-							// if not a string, but a binop:
-						} else if binExpr, ok := firstArg.(*ast.BinaryExpr); ok && binExpr.Op == token.ADD {
-							// note: plz reformat not to use adds
-							Logger.Debug("\n   found a binary expr instead of str; fix your code")
-
-						} else {
-							Logger.Debugf("\n   found something else: %T", firstArg)
+				// determine if method is one of the validated ones; if so, check the text arg (which should be a string)
+				if spec, fmtCall, ok := l.matchCall(pkg.TypesInfo, callExpr); ok && len(callExpr.Args) > spec.text {
+					funcName := callee(callExpr)
+					Logger.Debug("\n  found call to " + spec.name)
+					firstArg := callExpr.Args[spec.text]
+
+					if fmtCall && callExpr.Ellipsis.IsValid() {
+						Logger.Warnf("%s: skipping call to %s: format args passed with ...", l.Fset.Position(firstArg.Pos()), spec.name)
+						return true
+					}
+					var fmtArgs []ast.Expr
+					if fmtCall && len(callExpr.Args) > spec.args {
+						fmtArgs = callExpr.Args[spec.args:]
+					}
+					textArg, isFmtText, wrapErr := firstArg, fmtCall, false
+					if !fmtCall {
+						// replace a nested fmt.Sprintf as a whole
+						text, args, isErr, ok, err := l.unwrapFormatter(pkg.TypesInfo, firstArg)
+						if err != nil {
+							Logger.Warnf("%s: skipping call to %s: %s", l.Fset.Position(firstArg.Pos()), spec.name, err.Error())
+							return true
+						} else if ok {
+							textArg, fmtArgs, isFmtText, wrapErr = text, args, true, isErr
+						}
+					}
+
+					if data, textArgs, isFmt, ok, err := extractText(pkg.TypesInfo, textArg, isFmtText, fmtArgs); ok {
+						buf := bytes.NewBuffer([]byte{})
+						printer.Fprint(buf, l.Fset, firstArg)
+						Logger.Debugf("\n   found a string in funcname %s:\n%s", spec.name, buf.String())
+
+						var args *ast.CallExpr
+						var imports []string
+						src, ok := source(callExpr.Pos())
+						if !ok {
+							return true
+						}
+						if err == nil {
+							args, imports, err = l.injectTran(pkg.TypesInfo, name, data, textArgs, isFmt, src, hint(callExpr.Pos()))
+						}
+						if err != nil {
+							Logger.Warnf("%s: skipping call to %s: %s", l.Fset.Position(firstArg.Pos()), spec.name, err.Error())
+							return true
+						}
+
+						if fmtCall {
+							funcName.Name = l.getUnFmtFunc(pkg.TypesInfo, callExpr, spec.name)
+						}
+						var trnl ast.Expr = args
+						if wrapErr {
+							trnl = pkgCall("errors", "New", args)
+							imports = append(imports, "errors")
+						}
+						placeAt(trnl, firstArg.Pos(), firstArg.End())
+						callExpr.Args = replaceText(callExpr.Args, spec, fmtCall, trnl)
+						cursor.Replace(callExpr)
+						for _, imp := range imports {
+							needImports[imp] = true
+						}
+						needGolocImport = true
+						if src.inject {
+							langUses = append(langUses, newLangUse(funcs, args))
 						}
-					} else if caller, ok := funcCall.X.(*ast.Ident); ok && caller.Name == "goloc" {
+						return false
+
+					} else {
+						Logger.Debugf("\n   found something else: %T", firstArg)
+					}
+				} else if funcCall, ok := callExpr.Fun.(*ast.SelectorExpr); ok {
+					if caller, ok := funcCall.X.(*ast.Ident); ok && caller.Name == "goloc" {
 						// has already been translated, check if it isn't duplicated.
-						if funcCall.Sel.Name == "Trnl" || funcCall.Sel.Name == "Trnlf" {
-							if arg, ok := callExpr.Args[1].(*ast.BasicLit); ok && arg.Kind == token.STRING { // possible OOB
+						if isTrnlFunc(funcCall.Sel.Name) {
+							if len(callExpr.Args) < 2 {
+								return true
+							}
+							if arg, ok := callExpr.Args[1].(*ast.BasicLit); ok && arg.Kind == token.STRING {
 								val, err := strconv.Unquote(arg.Value)
 								if err != nil {
 									Logger.Fatal(err)
 									return true
 								}
-								itemName, ok := noDupStrings[data[l.DefaultLang][val].Value]
-								if ok {
+								defLangVal, known := l.catalog().get(l.DefaultLang, val)
+								h := hint(callExpr.Pos())
+								// unknown keys and empty texts can't be compared, so they're never merged.
+								text := rowText(defLangVal)
+								dedup := known && text != ""
+								itemName, ok := noDupStrings[dedupKey(text, defLangVal.Context)]
+								if dedup && ok {
 									val = itemName
+									addRef(name, val, h)
 								} else {
-									noDupStrings[data[l.DefaultLang][val].Value] = val
+									if dedup {
+										noDupStrings[dedupKey(text, defLangVal.Context)] = val
+									}
 									// add curr data to the new data (this will remove unused vals)
 									for lang := range newData {
-										currVal, ok := data[lang][val]
+										currVal, ok := l.catalog().get(lang, val)
 										if !ok {
-											defLangVal := data[l.DefaultLang][val]
 											currVal = Value{
 												Id:      defLangVal.Id,
 												Name:    defLangVal.Name,
+												Context: defLangVal.Context,
 												Value:   "",
+												Plurals: pluralSkeleton(lang, defLangVal),
+												Note:    defLangVal.Note,
 												Comment: defLangVal.Value,
 											}
 											// add to old data list, so its added at the start and offsets aren't changed.
 										}
+										// notes written in the catalog are kept, but uses are found again
+										if h.note != "" {
+											currVal.Note = h.note
+										}
+										currVal.Refs = []SourceRef{h.ref}
 										newData[lang][name][val] = currVal
 									}
 								}
@@ -266,17 +558,43 @@ func (l *Locer) Fix(node *ast.File) {
 								cursor.Replace(n)
 								return false
 							}
-						} else if funcCall.Sel.Name == "Add" || funcCall.Sel.Name == "Addf" {
-							if v, ok := callExpr.Args[0].(*ast.BasicLit); ok {
+						} else if add, ok := addFuncs[funcCall.Sel.Name]; ok && len(callExpr.Args) > add.text {
+							v := callExpr.Args[add.text]
+							h := hint(callExpr.Pos())
+							if add.context {
+								if h.context, ok = constString(pkg.TypesInfo, callExpr.Args[0]); !ok {
+									Logger.Warnf("%s: skipping call to %s: the context isn't a constant string", l.Fset.Position(v.Pos()), funcCall.Sel.Name)
+									return true
+								}
+							}
+							if data, textArgs, isFmt, ok, err := extractText(pkg.TypesInfo, v, add.fmtCall, callExpr.Args[add.text+1:]); ok {
 								buf := bytes.NewBuffer([]byte{})
 								printer.Fprint(buf, l.Fset, v)
 								Logger.Debugf("\n   found a string to add via Add(f):\n%s", buf.String())
 
-								callExpr, needStrconvImport = l.injectTran(name, callExpr, funcCall, v)
+								var call *ast.CallExpr
+								var imports []string
+								src, ok := source(callExpr.Pos())
+								if !ok {
+									return true
+								}
+								if err == nil {
+									call, imports, err = l.injectTran(pkg.TypesInfo, name, data, textArgs, isFmt, src, h)
+								}
+								if err != nil {
+									Logger.Warnf("%s: skipping call to %s: %s", l.Fset.Position(v.Pos()), funcCall.Sel.Name, err.Error())
+									return true
+								}
 
-								cursor.Replace(callExpr)
+								placeAt(call, callExpr.Pos(), callExpr.End())
+								cursor.Replace(call)
+								for _, imp := range imports {
+									needImports[imp] = true
+								}
 								needGolocImport = true
-								needsLangSetting = true
+								if src.inject {
+									langUses = append(langUses, newLangUse(funcs, call))
+								}
 								return false
 							}
 						}
@@ -288,43 +606,34 @@ func (l *Locer) Fix(node *ast.File) {
 		},
 		/*post*/
 		func(cursor *astutil.Cursor) bool {
-			if FuncDecl, ok := cursor.Node().(*ast.FuncDecl); ok && needsLangSetting {
-				if initExists && FuncDecl.Name.Name == "init" && needGolocImport {
-					if !initHasLoad(FuncDecl, name) {
-						FuncDecl.Body.List = append(FuncDecl.Body.List, loadModuleExpr)
-						cursor.Replace(FuncDecl)
-					}
-				}
-
-				if len(FuncDecl.Body.List) == 0 {
-					return true // do nothing
-				} else if ass, ok := FuncDecl.Body.List[0].(*ast.AssignStmt); ok {
-					// todo: stronger check
-					if i, ok := ass.Lhs[0].(*ast.Ident); ok && i.Name == "lang" { // check/update generator
-						return true // continue and ignore
-					}
-				}
-
-				Logger.Debug("adding lang to " + name)
-				FuncDecl.Body.List = append([]ast.Stmt{
-					&ast.AssignStmt{
-						Lhs: []ast.Expr{&ast.Ident{Name: "lang"}},
-						Tok: token.DEFINE,
-						Rhs: []ast.Expr{
-							&ast.CallExpr{
-								Fun:  &ast.Ident{Name: "getLang"},       // todo: parameterise
-								Args: []ast.Expr{&ast.Ident{Name: "u"}}, // todo: figure this bit out
-							},
-						},
-					},
-				}, FuncDecl.Body.List...)
-				cursor.Replace(FuncDecl)
-				needsLangSetting = false
+			switch cursor.Node().(type) {
+			case *ast.FuncDecl:
+				decl = nil // package-level func literals after it aren't part of it
+			case *ast.FuncLit:
+			default:
+				return true
 			}
+			funcs = funcs[:len(funcs)-1]
 			return true
 		},
 	)
 
+	// declare lang at the start of the functions using it, once all their uses are known. It's placed right after the
+	// opening brace, so that comments on the first statement, such as notes for translators, stay with it.
+	injectFuncs, injectNames := injectLangs(pkg.TypesInfo, langUses)
+	for _, fn := range injectFuncs {
+		body := bodies[fn]
+		Logger.Debug("adding " + injectNames[fn] + " to function in " + name)
+		body.List = append([]ast.Stmt{
+			&ast.AssignStmt{
+				Lhs:    []ast.Expr{&ast.Ident{Name: injectNames[fn], NamePos: body.Lbrace}},
+				TokPos: body.Lbrace,
+				Tok:    token.DEFINE,
+				Rhs:    []ast.Expr{&ast.Ident{Name: langExpr.Name, NamePos: body.Lbrace}},
+			},
+		}, body.List...)
+	}
+
 	astutil.Apply(node, func(cursor *astutil.Cursor) bool {
 		return true
 	}, func(cursor *astutil.Cursor) bool {
@@ -335,12 +644,10 @@ func (l *Locer) Fix(node *ast.File) {
 				Body: &ast.BlockStmt{List: []ast.Stmt{loadModuleExpr}},
 			}
 			cursor.InsertAfter(v)
-		} else if ret, ok := cursor.Node().(*ast.FuncDecl); ok && needsLangSetting {
-			if initExists && ret.Name.Name == "init" && needGolocImport {
-				if !initHasLoad(ret, name) {
-					ret.Body.List = append(ret.Body.List, loadModuleExpr)
-					cursor.Replace(ret)
-				}
+		} else if ret, ok := cursor.Node().(*ast.FuncDecl); ok && ret.Recv == nil && ret.Name.Name == "init" && needGolocImport {
+			if !initHasLoad(ret, name) {
+				ret.Body.List = append(ret.Body.List, loadModuleExpr)
+				cursor.Replace(ret)
 			}
 		}
 		return true
@@ -351,14 +658,19 @@ func (l *Locer) Fix(node *ast.File) {
 		ast.SortImports(l.Fset, node)
 	}
 
-	if needStrconvImport {
-		astutil.AddImport(l.Fset, node, "strconv")
+	for imp := range needImports {
+		astutil.AddImport(l.Fset, node, imp)
 		ast.SortImports(l.Fset, node)
 	}
+	for _, imp := range usedImports {
+		if !needImports[imp] && !astutil.UsesImport(node, imp) {
+			astutil.DeleteImport(l.Fset, node, imp)
+		}
+	}
 
 	out := os.Stdout
 	if l.Apply {
-		f, err := os.Create(name)
+		f, err := os.Create(l.Fset.File(node.Pos()).Name())
 		if err != nil {
 			Logger.Fatal(err)
 			return
@@ -379,7 +691,7 @@ func (l *Locer) Fix(node *ast.File) {
 }
 
 func (l *Locer) Create(args []string, lang language.Tag) {
-	err := filepath.Walk(path.Join(translationDir, l.DefaultLang),
+	err := filepath.Walk(filepath.Join(l.dir(), l.DefaultLang),
 		func(fpath string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
@@ -402,7 +714,11 @@ func (l *Locer) Create(args []string, lang language.Tag) {
 
 			for i := 0; i < len(xmlData.Rows); i++ {
 				xmlData.Rows[i].Comment = xmlData.Rows[i].Value
+				if other, ok := xmlData.Rows[i].plural("other"); ok && xmlData.Rows[i].Value == "" {
+					xmlData.Rows[i].Comment = other
+				}
 				xmlData.Rows[i].Value = ""
+				xmlData.Rows[i].Plurals = pluralSkeleton(lang.String(), xmlData.Rows[i])
 			}
 
 			filename := strings.Replace(fpath, sep(l.DefaultLang), sep(lang.String()), 1)
@@ -431,10 +747,10 @@ func (l *Locer) Create(args []string, lang language.Tag) {
 }
 
 func (l *Locer) CheckAll() error {
-	LoadAll(l.DefaultLang)
+	l.catalog().LoadAll(l.DefaultLang)
 
 	v := getHTMLValidator()
-	for lang := range data {
+	for _, lang := range l.catalog().Languages() {
 		if err := l.check(v, lang); err != nil {
 			return err
 		}
@@ -443,8 +759,8 @@ func (l *Locer) CheckAll() error {
 }
 
 func (l *Locer) Check(lang string) error {
-	LoadLangAll(l.DefaultLang)
-	LoadLangAll(lang)
+	l.catalog().LoadLangAll(l.DefaultLang)
+	l.catalog().LoadLangAll(lang)
 
 	err := l.check(getHTMLValidator(), lang)
 	if err != nil {
@@ -478,38 +794,81 @@ func (l *Locer) check(v htmlcheck.Validator, lang string) error {
 		return nil
 	}
 
-	for s, d := range data[lang] {
+	for s, d := range l.catalog().values(lang) {
 		if s != d.Name {
 			Logger.Errorf("%s: '%s'\tfatally incorrect", lang, s)
 			continue
 		}
-		defLangVal := data[l.DefaultLang][s]
+		defLangVal, _ := l.catalog().get(l.DefaultLang, s)
 
 		if defLangVal.Id != d.Id {
 			Logger.Errorf("%s: '%s'\thas different ids from default language %s", lang, s, l.DefaultLang)
 			continue
 		}
 
-		if defLangVal.Value == d.Value {
-			// Same; skip.
+		if len(defLangVal.Plurals) > 0 {
+			if err := checkPlurals(lang, d); err != nil {
+				Logger.Errorf("%s: '%s'\tplural error: %s", lang, s, err.Error())
+			}
+			for _, p := range d.Plurals {
+				if p.Value == "" {
+					continue // already reported as missing
+				}
+				defPlural, ok := defLangVal.plural(p.Form)
+				if !ok {
+					defPlural, _ = defLangVal.plural("other")
+				}
+				checkValue(v, lang, s+"["+p.Form+"]", defPlural, p.Value)
+			}
 			continue
 		}
 
-		if err := checkCurlies(defLangVal.Value, d.Value); err != nil {
-			Logger.Errorf("%s: '%s'\tcurlies mismatch: %s", lang, s, err.Error())
+		checkValue(v, lang, s, defLangVal.Value, d.Value)
+	}
+	// TODO: investigate changing decoder
+	return nil
+}
+
+// checkValue logs all the issues found in a translated string, when compared to its default language version.
+func checkValue(v htmlcheck.Validator, lang string, name string, def string, custom string) {
+	if def == custom {
+		// Same; skip.
+		return
+	}
 
+	if err := checkCurlies(def, custom); err != nil {
+		Logger.Errorf("%s: '%s'\tcurlies mismatch: %s", lang, name, err.Error())
+
+	}
+	if err := checkValidHTML(v, def, custom); err != nil {
+		Logger.Errorf("%s: '%s'\tHTML error: %s", lang, name, err.Error())
+	}
+	//if err := checkWS(def, custom); err != nil {
+	//	Logger.Errorf("%s: '%s'\twhitespace error: %s", lang, name, err.Error())
+	//}
+	if err := checkForSymbols(def, custom); err != nil {
+		Logger.Errorf("%s: '%s'\tsymbols error: %s", lang, name, err.Error())
+	}
+}
+
+// checkPlurals ensures that every plural form needed by lang has been translated, and that no unknown forms are used.
+func checkPlurals(lang string, custom Value) error {
+	forms := PluralForms(lang)
+	for _, p := range custom.Plurals {
+		if !contains(forms, p.Form) {
+			return fmt.Errorf("unknown plural form '%s' (expected %s)", p.Form, strings.Join(forms, ", "))
 		}
-		if err := checkValidHTML(v, defLangVal.Value, d.Value); err != nil {
-			Logger.Errorf("%s: '%s'\tHTML error: %s", lang, s, err.Error())
-		}
-		//if err := checkWS(defLangVal.Value, d.Value); err != nil {
-		//	Logger.Errorf("%s: '%s'\twhitespace error: %s", lang, s, err.Error())
-		//}
-		if err := checkForSymbols(defLangVal.Value, d.Value); err != nil {
-			Logger.Errorf("%s: '%s'\tsymbols error: %s", lang, s, err.Error())
+	}
+
+	var missing []string
+	for _, f := range forms {
+		if _, ok := custom.plural(f); !ok {
+			missing = append(missing, f)
 		}
 	}
-	// TODO: investigate changing decoder
+	if len(missing) > 0 {
+		return fmt.Errorf("missing plural forms: %s", strings.Join(missing, ", "))
+	}
 	return nil
 }
 
@@ -577,7 +936,12 @@ func checkForSymbols(def string, custom string) error {
 var curliesRex = regexp.MustCompile(`\{\d+?\}`)
 
 // Basic regex check to see if expected matches. Should be good enough for now.
+// Strings using MessageFormat plural, select or typed arguments are compared by the arguments they use instead.
 func checkCurlies(def string, custom string) error {
+	if err := checkMessageArgs(def, custom); err != errNotComplex {
+		return err
+	}
+
 	defMatches := curliesRex.FindAllStringSubmatch(def, -1)
 	customMatches := curliesRex.FindAllStringSubmatch(custom, -1)
 
@@ -614,15 +978,36 @@ func checkCurlies(def string, custom string) error {
 	return nil
 }
 
-func (l *Locer) getUnFmtFunc(name string) string {
+// isTrnlFunc reports whether name is a goloc function which takes the language (or a context) and translation key as
+// its first arguments.
+func isTrnlFunc(name string) bool {
+	switch name {
+	case "Trnl", "Trnlf", "Trnlfv", "TrnlfArgs", "TrnlPlural", "T", "Tf", "Tfv":
+		return true
+	}
+	return false
+}
+
+// getUnFmtFunc returns the name to call instead of the format function called by call, which was matched by spec: if
+// the function without the trailing f is also extracted, the formatting is left to the translation.
+func (l *Locer) getUnFmtFunc(info *types.Info, call *ast.CallExpr, spec string) string {
+	name := callee(call).Name
 	if !strings.HasSuffix(name, "f") {
 		// not a formatting function; all ok.
 		return name
 	}
+	fn := unFmtFunc(info, call)
 	for _, f := range l.Funcs {
-		if f+"f" == name {
+		s, err := parseFuncSpec(f)
+		if err != nil {
+			continue
+		}
+		if s.name == strings.TrimSuffix(spec, "f") {
 			// found simple func; return.
-			return f
+			return strings.TrimSuffix(name, "f")
+		}
+		if fn != nil && strings.Contains(s.name, ".") && funcNameMatches(fn, s.name) {
+			return fn.Name()
 		}
 	}
 	// no result found; return current.
@@ -0,0 +1,249 @@
+package goloc
+
+import (
+	"go/token"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go.uber.org/zap/zaptest"
+)
+
+// golocStub declares the goloc functions used by extracted code, so that test modules type-check without the real
+// package and its dependencies.
+const golocStub = `package goloc
+
+import "context"
+
+func Load(module string)                                                   {}
+func Trnl(lang string, key string) string                                  { return key }
+func Trnlf(lang string, key string, args map[string]string) string         { return key }
+func Trnlfv(lang string, key string, args ...interface{}) string           { return key }
+func T(ctx context.Context, key string) string                             { return key }
+func Tf(ctx context.Context, key string, args map[string]string) string     { return key }
+func Tfv(ctx context.Context, key string, args ...interface{}) string       { return key }
+func Add(text string) string                                               { return text }
+func Addf(text string, args ...interface{}) string                         { return text }
+func AddCtx(context string, text string) string                            { return text }
+func AddCtxf(context string, text string, args ...interface{}) string      { return text }
+`
+
+// testModule writes a module holding files, with a stub of goloc, and returns its directory.
+func testModule(t *testing.T, files map[string]string) string {
+	t.Helper()
+	dir := t.TempDir()
+	stub := map[string]string{
+		"go.mod": "module example.com/m\n\ngo 1.21\n\nrequire github.com/PaulSonOfLars/goloc v0.0.0\n\n" +
+			"replace github.com/PaulSonOfLars/goloc => ./goloc\n",
+		"goloc/go.mod":   "module github.com/PaulSonOfLars/goloc\n\ngo 1.21\n",
+		"goloc/goloc.go": golocStub,
+	}
+	for name, src := range stub {
+		writeTestFile(t, filepath.Join(dir, name), src)
+	}
+	for name, src := range files {
+		writeTestFile(t, filepath.Join(dir, name), src)
+	}
+	return dir
+}
+
+func writeTestFile(t *testing.T, fpath string, src string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fpath, []byte(src), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readTestFile(t *testing.T, fpath string) string {
+	t.Helper()
+	data, err := os.ReadFile(fpath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+// newTestLocer returns a Locer extracting calls to Send into the trans directory of the module at dir.
+func newTestLocer(t *testing.T, dir string) *Locer {
+	t.Helper()
+	Logger = zaptest.NewLogger(t).Sugar()
+	return &Locer{
+		DefaultLang: "en-GB",
+		Funcs:       []string{"Send"},
+		Checked:     make(map[string]struct{}),
+		Fset:        token.NewFileSet(),
+		Apply:       true,
+		Dir:         filepath.Join(dir, "trans"),
+	}
+}
+
+// extract runs extraction over the module at dir, with the Locer changed by opts, and returns the new source of a.go.
+func extract(t *testing.T, dir string, opts func(l *Locer)) string {
+	t.Helper()
+	t.Chdir(dir) // packages are loaded from the working directory
+	l := newTestLocer(t, dir)
+	if opts != nil {
+		opts(l)
+	}
+	if err := l.Handle([]string{dir}, l.Fix); err != nil {
+		t.Fatal(err)
+	}
+	return readTestFile(t, filepath.Join(dir, "a.go"))
+}
+
+// wantLines checks that src holds lines, in order, each of which is compared without its indentation.
+func wantLines(t *testing.T, src string, lines ...string) {
+	t.Helper()
+	var got []string
+	for _, line := range strings.Split(src, "\n") {
+		got = append(got, strings.TrimSpace(line))
+	}
+	i := 0
+	for _, line := range got {
+		if i < len(lines) && line == lines[i] {
+			i++
+		}
+	}
+	if i < len(lines) {
+		t.Errorf("missing line %q in:\n%s", lines[i], src)
+	}
+}
+
+func TestExtractKeepsComments(t *testing.T) {
+	dir := testModule(t, map[string]string{"a.go": `package m
+
+import "fmt"
+
+type Bot struct{}
+
+func (b *Bot) Send(s string) {}
+
+func getLang(u string) string { return u }
+
+func F(b *Bot, u string, n int) {
+	b.Send("Zero")
+	// TRANSLATORS: verb on a button
+	b.Send("Open")
+	//goloc:context noun
+	b.Send(fmt.Sprintf("Count %d", n)) // trailing
+	//goloc:key last_one
+	b.Send("Last")
+}
+`})
+	want := []string{
+		`lang := getLang(u)`,
+		`b.Send(goloc.Trnl(lang, "a.go:1"))`,
+		`// TRANSLATORS: verb on a button`,
+		`b.Send(goloc.Trnl(lang, "a.go:2"))`,
+		`//goloc:context noun`,
+		`b.Send(goloc.Trnlf(lang, "a.go:3", map[string]string{"1": strconv.Itoa(n)})) // trailing`,
+		`//goloc:key last_one`,
+		`b.Send(goloc.Trnl(lang, "last_one"))`,
+		`}`,
+	}
+	first := extract(t, dir, nil)
+	wantLines(t, first, want...)
+
+	// extracting again finds the same comments, in the same places.
+	second := extract(t, dir, nil)
+	if second != first {
+		t.Errorf("second extraction changed the source:\n%s\nwant:\n%s", second, first)
+	}
+	catalog := readTestFile(t, filepath.Join(dir, "trans", "en-GB", "a.xml"))
+	for _, s := range []string{`<note>verb on a button</note>`, `context="noun"`, `name="last_one"`} {
+		if !strings.Contains(catalog, s) {
+			t.Errorf("catalog is missing %s:\n%s", s, catalog)
+		}
+	}
+}
+
+func TestExtractLangScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    []string
+		injects int // number of lang variables declared
+	}{
+		{
+			name: "closure after a use",
+			body: `b.Send("Outer")
+	func() { b.Send("Inner") }()`,
+			want:    []string{`lang := getLang(u)`, `b.Send(goloc.Trnl(lang, "a.go:1"))`, `func() { b.Send(goloc.Trnl(lang, "a.go:2")) }()`},
+			injects: 1,
+		},
+		{
+			name: "closure before a use",
+			body: `go func() {
+		b.Send("Inner")
+	}()
+	b.Send("Outer")`,
+			want:    []string{`lang := getLang(u)`, `b.Send(goloc.Trnl(lang, "a.go:1"))`, `b.Send(goloc.Trnl(lang, "a.go:2"))`},
+			injects: 1,
+		},
+		{
+			name: "nested closures",
+			body: `b.Send("Outer")
+	func() {
+		func() { b.Send("Inner") }()
+	}()`,
+			want:    []string{`lang := getLang(u)`, `func() { b.Send(goloc.Trnl(lang, "a.go:2")) }()`},
+			injects: 1,
+		},
+		{
+			name: "sibling closures",
+			body: `func() { b.Send("One") }()
+	func() { b.Send("Two") }()`,
+			want: []string{
+				`func() { lang := getLang(u); b.Send(goloc.Trnl(lang, "a.go:1")) }()`,
+				`func() { lang := getLang(u); b.Send(goloc.Trnl(lang, "a.go:2")) }()`,
+			},
+			injects: 2,
+		},
+		{
+			name: "shadowed in a closure",
+			body: `b.Send("Outer")
+	func() {
+		lang := 1
+		_ = lang
+		b.Send("Inner")
+	}()`,
+			want:    []string{`lang2 := getLang(u)`, `b.Send(goloc.Trnl(lang2, "a.go:1"))`, `b.Send(goloc.Trnl(lang2, "a.go:2"))`},
+			injects: 1,
+		},
+		{
+			name: "existing variable",
+			body: `lang := getLang(u)
+	_ = lang
+	func() { b.Send("Inner") }()`,
+			want:    []string{`lang := getLang(u)`, `func() { b.Send(goloc.Trnl(lang, "a.go:1")) }()`},
+			injects: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := testModule(t, map[string]string{"a.go": `package m
+
+import "strings"
+
+type Bot struct{}
+
+func (b *Bot) Send(s string) {}
+
+func getLang(u string) string { return strings.ToLower(u) }
+
+func F(b *Bot, u string) {
+	` + tt.body + `
+}
+`})
+			src := extract(t, dir, nil)
+			wantLines(t, src, tt.want...)
+			if n := strings.Count(src, ":= getLang(u)") - strings.Count(tt.body, ":= getLang(u)"); n != tt.injects {
+				t.Errorf("got %d lang variables, want %d:\n%s", n, tt.injects, src)
+			}
+		})
+	}
+}
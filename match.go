@@ -0,0 +1,256 @@
+package goloc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/types"
+	"strconv"
+	"strings"
+)
+
+// callee returns the identifier naming the function called by call, if any.
+func callee(call *ast.CallExpr) *ast.Ident {
+	switch fun := call.Fun.(type) {
+	case *ast.Ident:
+		return fun
+	case *ast.SelectorExpr:
+		return fun.Sel
+	}
+	return nil
+}
+
+// funcSpec is a function to extract strings from, as given in Funcs or Fmtfuncs: name[:text[:args]]. text is the
+// index of the argument holding the text, and defaults to 0; args is the index of the first format argument, and
+// defaults to the one after the text. For example, errors.Wrap:1 or (*bot.Bot).NewMessagef:1:2.
+type funcSpec struct {
+	name string
+	text int
+	args int
+}
+
+func parseFuncSpec(s string) (funcSpec, error) {
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return funcSpec{}, fmt.Errorf("invalid func %q: expected name[:text[:args]]", s)
+	}
+	spec := funcSpec{name: parts[0]}
+	var err error
+	if len(parts) > 1 {
+		if spec.text, err = strconv.Atoi(parts[1]); err != nil || spec.text < 0 {
+			return funcSpec{}, fmt.Errorf("invalid text index in func %q", s)
+		}
+	}
+	spec.args = spec.text + 1
+	if len(parts) > 2 {
+		if spec.args, err = strconv.Atoi(parts[2]); err != nil || spec.args <= spec.text {
+			return funcSpec{}, fmt.Errorf("invalid args index in func %q: it must come after the text", s)
+		}
+	}
+	return spec, nil
+}
+
+// DefaultFormatters are the Formatters used when none are set.
+var DefaultFormatters = []string{"fmt.Sprintf", "fmt.Errorf"}
+
+func (l *Locer) formatters() []string {
+	if l.Formatters == nil {
+		return DefaultFormatters
+	}
+	return l.Formatters
+}
+
+// unwrapFormatter returns the text and format arguments of expr if it's a call to one of the formatters, such as
+// fmt.Sprintf, so that the whole call can be replaced by a single translation. wrapErr is set when the formatter
+// returns an error, like fmt.Errorf, so the translation has to be wrapped by errors.New.
+func (l *Locer) unwrapFormatter(info *types.Info, expr ast.Expr) (text ast.Expr, fmtArgs []ast.Expr, wrapErr bool, ok bool, err error) {
+	call, ok := unparen(expr).(*ast.CallExpr)
+	if !ok {
+		return nil, nil, false, false, nil
+	}
+	spec, ok := matchFunc(info, call, l.formatters())
+	if !ok || len(call.Args) <= spec.text {
+		return nil, nil, false, false, nil
+	}
+	if call.Ellipsis.IsValid() {
+		return nil, nil, false, true, errors.New("format args passed with ...")
+	}
+	if len(call.Args) > spec.args {
+		fmtArgs = call.Args[spec.args:]
+	}
+	return call.Args[spec.text], fmtArgs, info != nil && isError(info.TypeOf(call)), true, nil
+}
+
+func isError(t types.Type) bool {
+	return t != nil && types.Identical(t, types.Universe.Lookup("error").Type())
+}
+
+// checkSpecs ensures that every entry of Funcs, Fmtfuncs, Formatters and Fields can be parsed.
+func (l *Locer) checkSpecs() error {
+	for _, s := range append(append(append([]string(nil), l.Funcs...), l.Fmtfuncs...), l.Formatters...) {
+		if _, err := parseFuncSpec(s); err != nil {
+			return err
+		}
+	}
+	for _, s := range l.Fields {
+		if _, err := parseFieldSpec(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// matchCall returns the spec of the extracted function called by call, and whether it's a format function.
+func (l *Locer) matchCall(info *types.Info, call *ast.CallExpr) (funcSpec, bool, bool) {
+	if spec, ok := matchFunc(info, call, l.Fmtfuncs); ok {
+		return spec, true, true
+	}
+	if spec, ok := matchFunc(info, call, l.Funcs); ok {
+		return spec, false, true
+	}
+	return funcSpec{}, false, false
+}
+
+// matchFunc returns the entry of funcs which names the function called by call. Qualified entries, such as
+// fmt.Printf, (*tgbotapi.BotAPI).Send or example.com/bot.Reply, are matched against the function or method the call
+// resolves to. Bare names are matched against the selector of any call, as they always have been. Invalid entries
+// are ignored; see checkSpecs.
+func matchFunc(info *types.Info, call *ast.CallExpr, funcs []string) (funcSpec, bool) {
+	id := callee(call)
+	if id == nil {
+		return funcSpec{}, false
+	}
+
+	var fn *types.Func
+	if info != nil {
+		fn, _ = info.Uses[id].(*types.Func)
+	}
+	_, isSel := call.Fun.(*ast.SelectorExpr)
+	for _, s := range funcs {
+		spec, err := parseFuncSpec(s)
+		if err != nil {
+			continue
+		}
+		if !strings.Contains(spec.name, ".") {
+			if isSel && spec.name == id.Name {
+				return spec, true
+			}
+			continue
+		}
+		if fn != nil && funcNameMatches(fn, spec.name) {
+			return spec, true
+		}
+	}
+	return funcSpec{}, false
+}
+
+// fieldSpec is a struct field to extract strings from in composite literals, as given in Fields: Type.Field, where
+// Type is qualified like the names of funcs, such as cobra.Command.Short or example.com/bot.Button.Text.
+type fieldSpec struct {
+	typ   string
+	field string
+}
+
+func parseFieldSpec(s string) (fieldSpec, error) {
+	i := strings.LastIndex(s, ".")
+	if i <= 0 || i == len(s)-1 {
+		return fieldSpec{}, fmt.Errorf("invalid field %q: expected Type.Field", s)
+	}
+	return fieldSpec{typ: s[:i], field: s[i+1:]}, nil
+}
+
+// matchFields returns the fields to extract from lit, based on its type.
+func (l *Locer) matchFields(info *types.Info, lit *ast.CompositeLit) []string {
+	if info == nil {
+		return nil
+	}
+	t := info.TypeOf(lit)
+	if p, ok := t.(*types.Pointer); ok {
+		t = p.Elem()
+	}
+	named, ok := t.(*types.Named)
+	if !ok {
+		return nil
+	}
+
+	var fields []string
+	for _, s := range l.Fields {
+		spec, err := parseFieldSpec(s)
+		if err != nil {
+			continue
+		}
+		if typeNameMatches(named, spec.typ) {
+			fields = append(fields, spec.field)
+		}
+	}
+	return fields
+}
+
+// fieldText returns the value assigned by kv in lit, if it's an extracted field.
+func (l *Locer) fieldText(info *types.Info, lit *ast.CompositeLit, kv *ast.KeyValueExpr) (ast.Expr, bool) {
+	key, ok := kv.Key.(*ast.Ident)
+	if !ok {
+		return nil, false
+	}
+	return kv.Value, contains(l.matchFields(info, lit), key.Name)
+}
+
+// typeNameMatches reports whether name is t qualified by its package path or package name, or just its bare name.
+func typeNameMatches(t *types.Named, name string) bool {
+	if !strings.Contains(name, ".") {
+		return t.Obj().Name() == name
+	}
+	for _, qual := range []types.Qualifier{pkgPath, pkgName} {
+		if types.TypeString(t, qual) == name {
+			return true
+		}
+	}
+	return false
+}
+
+// funcNameMatches reports whether spec names fn, qualified by either its package path or its package name. Pointer
+// and value receivers are treated alike, since both can be used to call the method.
+func funcNameMatches(fn *types.Func, spec string) bool {
+	spec = strings.ReplaceAll(spec, "*", "")
+	for _, qual := range []types.Qualifier{pkgPath, pkgName} {
+		if strings.ReplaceAll(qualifiedName(fn, qual), "*", "") == spec {
+			return true
+		}
+	}
+	return false
+}
+
+func pkgPath(p *types.Package) string { return p.Path() }
+func pkgName(p *types.Package) string { return p.Name() }
+
+// qualifiedName returns the name of fn in the same form as types.Func.FullName, using qual for package names.
+func qualifiedName(fn *types.Func, qual types.Qualifier) string {
+	sig := fn.Type().(*types.Signature)
+	if recv := sig.Recv(); recv != nil {
+		return "(" + types.TypeString(recv.Type(), qual) + ")." + fn.Name()
+	}
+	if fn.Pkg() != nil {
+		return qual(fn.Pkg()) + "." + fn.Name()
+	}
+	return fn.Name()
+}
+
+// unFmtFunc returns the function or method named like the one called by call without its trailing f, such as
+// fmt.Print for fmt.Printf.
+func unFmtFunc(info *types.Info, call *ast.CallExpr) *types.Func {
+	if info == nil {
+		return nil
+	}
+	fn, ok := info.Uses[callee(call)].(*types.Func)
+	if !ok || fn.Pkg() == nil || !strings.HasSuffix(fn.Name(), "f") {
+		return nil
+	}
+	name := strings.TrimSuffix(fn.Name(), "f")
+	if recv := fn.Type().(*types.Signature).Recv(); recv != nil {
+		obj, _, _ := types.LookupFieldOrMethod(recv.Type(), true, fn.Pkg(), name)
+		m, _ := obj.(*types.Func)
+		return m
+	}
+	f, _ := fn.Pkg().Scope().Lookup(name).(*types.Func)
+	return f
+}
@@ -0,0 +1,546 @@
+package goloc
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// message is a parsed ICU MessageFormat string, such as "{gender, select, female {She} other {They}} joined".
+type message []msgNode
+
+type nodeKind int
+
+const (
+	nodeText   nodeKind = iota // literal text
+	nodeArg                    // {name} or {name, type, style}
+	nodeHash                   // # inside a plural case
+	nodePlural                 // {name, plural, ...} or {name, selectordinal, ...}
+	nodeSelect                 // {name, select, ...}
+)
+
+type msgNode struct {
+	kind    nodeKind
+	text    string    // literal text of a nodeText
+	arg     string    // argument name
+	typ     string    // argument type of a nodeArg, if any
+	style   string    // argument style of a nodeArg, if any
+	ordinal bool      // selectordinal rather than plural
+	offset  int       // plural offset
+	cases   []msgCase // plural and select cases, in source order
+}
+
+type msgCase struct {
+	key string // "=0", "one", "female", "other"...
+	msg message
+}
+
+type msgParser struct {
+	s      string
+	pos    int
+	quotes bool // apostrophes quote text
+}
+
+// parseMessage parses an ICU MessageFormat string. In messages using plural, select or typed arguments, apostrophes
+// follow the ICU rules: a doubled apostrophe is a literal one, and a single apostrophe only starts quoted text when it
+// comes before a syntax character. Apostrophes in any other message are literal, so that plain translations such as
+// "Impossible d'{1} le fichier" keep their meaning.
+func parseMessage(s string) (message, error) {
+	if m, err := parseMessageQuotes(s, true); err == nil && m.isComplex() {
+		return m, nil
+	}
+	return parseMessageQuotes(s, false)
+}
+
+func parseMessageQuotes(s string, quotes bool) (message, error) {
+	p := &msgParser{s: s, quotes: quotes}
+	m, err := p.parse(false)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.s) {
+		return nil, fmt.Errorf("unexpected '}' at offset %d", p.pos)
+	}
+	return m, nil
+}
+
+// parse reads a message until the end of the input, or until the closing brace of the enclosing case.
+func (p *msgParser) parse(inPlural bool) (message, error) {
+	var m message
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			m = append(m, msgNode{kind: nodeText, text: text.String()})
+			text.Reset()
+		}
+	}
+
+	for p.pos < len(p.s) {
+		switch c := p.s[p.pos]; {
+		case c == '\'' && p.quotes:
+			p.pos++
+			if p.pos < len(p.s) && p.s[p.pos] == '\'' {
+				text.WriteByte('\'')
+				p.pos++
+			} else if p.pos < len(p.s) && p.isSyntax(p.s[p.pos], inPlural) {
+				text.WriteString(p.quoted())
+			} else {
+				text.WriteByte('\'')
+			}
+		case c == '{':
+			flush()
+			n, err := p.parseArg()
+			if err != nil {
+				return nil, err
+			}
+			m = append(m, n)
+		case c == '}':
+			flush()
+			return m, nil
+		case c == '#' && inPlural:
+			flush()
+			m = append(m, msgNode{kind: nodeHash})
+			p.pos++
+		default:
+			text.WriteByte(c)
+			p.pos++
+		}
+	}
+	flush()
+	return m, nil
+}
+
+func (p *msgParser) isSyntax(c byte, inPlural bool) bool {
+	return c == '{' || c == '}' || c == '|' || (c == '#' && inPlural)
+}
+
+// quoted reads quoted text up to the closing apostrophe, which is consumed.
+func (p *msgParser) quoted() string {
+	var sb strings.Builder
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		p.pos++
+		if c != '\'' {
+			sb.WriteByte(c)
+			continue
+		}
+		if p.pos < len(p.s) && p.s[p.pos] == '\'' {
+			sb.WriteByte('\'')
+			p.pos++
+			continue
+		}
+		break
+	}
+	return sb.String()
+}
+
+func (p *msgParser) skipWS() {
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n", p.s[p.pos]) >= 0 {
+		p.pos++
+	}
+}
+
+// ident reads a name, up to the next whitespace or syntax character.
+func (p *msgParser) ident() string {
+	start := p.pos
+	for p.pos < len(p.s) && strings.IndexByte(" \t\r\n,{}", p.s[p.pos]) < 0 {
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+func (p *msgParser) expect(c byte) error {
+	p.skipWS()
+	if p.pos >= len(p.s) {
+		return fmt.Errorf("expected '%c', got end of message", c)
+	}
+	if p.s[p.pos] != c {
+		return fmt.Errorf("expected '%c' at offset %d, got '%c'", c, p.pos, p.s[p.pos])
+	}
+	p.pos++
+	return nil
+}
+
+// parseArg reads an argument, starting at its opening brace.
+func (p *msgParser) parseArg() (msgNode, error) {
+	p.pos++ // opening brace
+	p.skipWS()
+	n := msgNode{kind: nodeArg, arg: p.ident()}
+	if n.arg == "" {
+		return n, fmt.Errorf("missing argument name at offset %d", p.pos)
+	}
+	p.skipWS()
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		return n, nil
+	}
+	if err := p.expect(','); err != nil {
+		return n, err
+	}
+	p.skipWS()
+	n.typ = p.ident()
+	if n.typ == "" {
+		return n, fmt.Errorf("missing argument type for '%s'", n.arg)
+	}
+	p.skipWS()
+	if p.pos < len(p.s) && p.s[p.pos] == '}' {
+		p.pos++
+		if n.typ == "plural" || n.typ == "selectordinal" || n.typ == "select" {
+			return n, fmt.Errorf("missing cases for %s argument '%s'", n.typ, n.arg)
+		}
+		return n, nil
+	}
+	if err := p.expect(','); err != nil {
+		return n, err
+	}
+
+	switch n.typ {
+	case "plural", "selectordinal":
+		n.kind = nodePlural
+		n.ordinal = n.typ == "selectordinal"
+		p.skipWS()
+		if strings.HasPrefix(p.s[p.pos:], "offset:") {
+			p.pos += len("offset:")
+			p.skipWS()
+			off, err := strconv.Atoi(p.ident())
+			if err != nil {
+				return n, fmt.Errorf("invalid plural offset for '%s': %w", n.arg, err)
+			}
+			n.offset = off
+		}
+		return n, p.parseCases(&n, true)
+	case "select":
+		n.kind = nodeSelect
+		return n, p.parseCases(&n, false)
+	default:
+		n.style = strings.TrimSpace(p.style())
+		return n, p.expect('}')
+	}
+}
+
+// style reads a simple argument style, up to the closing brace of the argument.
+func (p *msgParser) style() string {
+	var sb strings.Builder
+	depth := 0
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		switch {
+		case c == '\'':
+			p.pos++
+			sb.WriteString(p.quoted())
+			continue
+		case c == '{':
+			depth++
+		case c == '}':
+			if depth == 0 {
+				return sb.String()
+			}
+			depth--
+		}
+		sb.WriteByte(c)
+		p.pos++
+	}
+	return sb.String()
+}
+
+// parseCases reads the cases of a plural or select argument, including the closing brace of the argument.
+func (p *msgParser) parseCases(n *msgNode, inPlural bool) error {
+	for {
+		p.skipWS()
+		if p.pos >= len(p.s) {
+			return fmt.Errorf("unterminated %s argument '%s'", n.typ, n.arg)
+		}
+		if p.s[p.pos] == '}' {
+			p.pos++
+			break
+		}
+		key := p.ident()
+		if key == "" {
+			return fmt.Errorf("missing case name in %s argument '%s' at offset %d", n.typ, n.arg, p.pos)
+		}
+		if err := p.expect('{'); err != nil {
+			return err
+		}
+		sub, err := p.parse(inPlural)
+		if err != nil {
+			return err
+		}
+		if err := p.expect('}'); err != nil {
+			return err
+		}
+		n.cases = append(n.cases, msgCase{key: key, msg: sub})
+	}
+
+	for _, c := range n.cases {
+		if c.key == "other" {
+			return nil
+		}
+	}
+	return fmt.Errorf("%s argument '%s' has no 'other' case", n.typ, n.arg)
+}
+
+// isComplex reports whether the message uses anything beyond plain {name} placeholders.
+func (m message) isComplex() bool {
+	for _, n := range m {
+		if n.kind == nodePlural || n.kind == nodeSelect || (n.kind == nodeArg && n.typ != "") {
+			return true
+		}
+	}
+	return false
+}
+
+// args returns the kind of every argument used in the message, including the ones nested in cases.
+func (m message) args(out map[string]string) map[string]string {
+	if out == nil {
+		out = make(map[string]string)
+	}
+	for _, n := range m {
+		switch n.kind {
+		case nodeArg, nodePlural, nodeSelect:
+			if _, ok := out[n.arg]; !ok {
+				out[n.arg] = n.typ
+			}
+		}
+		for _, c := range n.cases {
+			c.msg.args(out)
+		}
+	}
+	return out
+}
+
+// argFunc returns the value of a named argument, and whether it was given.
+type argFunc func(name string) (interface{}, bool)
+
+func stringArgs(dataMap map[string]string) argFunc {
+	return func(name string) (interface{}, bool) {
+		v, ok := dataMap[name]
+		return v, ok
+	}
+}
+
+func typedArgs(dataMap map[string]interface{}) argFunc {
+	return func(name string) (interface{}, bool) {
+		v, ok := dataMap[name]
+		return v, ok
+	}
+}
+
+// positionalArgs maps the argument names "1", "2"... to the given arguments.
+func positionalArgs(args []interface{}) argFunc {
+	return func(name string) (interface{}, bool) {
+		i, err := strconv.Atoi(name)
+		if err != nil || i < 1 || i > len(args) {
+			return nil, false
+		}
+		return args[i-1], true
+	}
+}
+
+// format writes the message to sb, using the rules of lang. Missing arguments are written back as placeholders.
+func (m message) format(sb *bytes.Buffer, lang string, args argFunc, hash string) {
+	for _, n := range m {
+		switch n.kind {
+		case nodeText:
+			sb.WriteString(n.text)
+		case nodeHash:
+			sb.WriteString(hash)
+		case nodeArg:
+			v, ok := args(n.arg)
+			if !ok {
+				sb.WriteByte('{')
+				sb.WriteString(n.arg)
+				sb.WriteByte('}')
+				continue
+			}
+			if s, ok := v.(string); ok && n.typ == "" {
+				sb.WriteString(s)
+				continue
+			}
+			sb.WriteString(formatArg(lang, n.typ, n.style, v))
+		case nodeSelect:
+			v, _ := args(n.arg)
+			key, ok := v.(string)
+			if !ok {
+				key = fmt.Sprint(v)
+			}
+			n.selectCase(key).format(sb, lang, args, hash)
+		case nodePlural:
+			v, _ := args(n.arg)
+			c, num := n.pluralCase(lang, v)
+			c.format(sb, lang, args, num)
+		}
+	}
+}
+
+func (n msgNode) selectCase(key string) message {
+	var other message
+	for _, c := range n.cases {
+		if c.key == key {
+			return c.msg
+		}
+		if c.key == "other" {
+			other = c.msg
+		}
+	}
+	return other
+}
+
+// pluralCase picks the case matching the number v, and returns it along with the formatted number to use for #.
+func (n msgNode) pluralCase(lang string, v interface{}) (message, string) {
+	s, ok := numberString(v)
+	num, err := strconv.ParseFloat(s, 64)
+	if !ok || err != nil {
+		return n.selectCase("other"), s
+	}
+	for _, c := range n.cases {
+		if strings.HasPrefix(c.key, "=") {
+			if exact, err := strconv.ParseFloat(c.key[1:], 64); err == nil && exact == num {
+				return c.msg, formatArg(lang, "number", "", s)
+			}
+		}
+	}
+
+	if n.offset != 0 {
+		s = strconv.FormatFloat(num-float64(n.offset), 'f', -1, 64)
+	}
+	rules := plural.Cardinal
+	if n.ordinal {
+		rules = plural.Ordinal
+	}
+	i, vis, w, f, t := pluralOperands(s)
+	return n.selectCase(pluralNames[rules.MatchPlural(language.Make(lang), i, vis, w, f, t)]), formatArg(lang, "number", "", s)
+}
+
+// pluralOperands returns the CLDR plural operands of a decimal number string.
+func pluralOperands(s string) (i, v, w, f, t int) {
+	s = strings.TrimLeft(s, "+-")
+	intPart, frac := s, ""
+	if idx := strings.IndexByte(s, '.'); idx >= 0 {
+		intPart, frac = s[:idx], s[idx+1:]
+	}
+	// operands can be passed modulo 10,000,000
+	if len(intPart) > 7 {
+		intPart = intPart[len(intPart)-7:]
+	}
+	if len(frac) > 7 {
+		frac = frac[:7]
+	}
+	trimmed := strings.TrimRight(frac, "0")
+	i, _ = strconv.Atoi(intPart)
+	f, _ = strconv.Atoi(frac)
+	t, _ = strconv.Atoi(trimmed)
+	return i, len(frac), len(trimmed), f, t
+}
+
+// template is a translated string, parsed when it was loaded so it can be formatted in a single pass.
+type template struct {
+	src string
+	msg message
+	err error // set if src isn't a valid MessageFormat string
+}
+
+func newTemplate(src string) *template {
+	m, err := parseMessage(src)
+	return &template{src: src, msg: m, err: err}
+}
+
+var bufPool = sync.Pool{
+	New: func() interface{} { return new(bytes.Buffer) },
+}
+
+// format fills in the arguments of t, using the rules of lang. Values which are not valid MessageFormat strings only
+// have their {name} placeholders replaced.
+func (t *template) format(lang string, args argFunc) string {
+	if t == nil {
+		return ""
+	}
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset()
+	if t.err != nil {
+		replacePlaceholders(buf, lang, t.src, args)
+	} else {
+		t.msg.format(buf, lang, args, "#")
+	}
+	s := buf.String()
+	bufPool.Put(buf)
+	return s
+}
+
+// replacePlaceholders writes src to sb, replacing every {name} for which an argument exists. Each placeholder runs
+// from a closing brace back to the nearest opening brace, so literal braces around it are kept: "Use {{1}}" gives
+// "Use {v}".
+func replacePlaceholders(sb *bytes.Buffer, lang string, src string, args argFunc) {
+	for {
+		end := strings.IndexByte(src, '}')
+		if end < 0 {
+			break
+		}
+		start := strings.LastIndexByte(src[:end], '{')
+		if start < 0 {
+			sb.WriteString(src[:end+1])
+			src = src[end+1:]
+			continue
+		}
+		sb.WriteString(src[:start])
+		if v, ok := args(src[start+1 : end]); ok {
+			sb.WriteString(formatArg(lang, "", "", v))
+		} else {
+			sb.WriteString(src[start : end+1])
+		}
+		src = src[end+1:]
+	}
+	sb.WriteString(src)
+}
+
+var errNotComplex = errors.New("not a complex message")
+
+// checkMessageArgs compares the arguments of two MessageFormat strings. It returns errNotComplex if neither uses more
+// than plain placeholders, in which case a simple placeholder count is more useful.
+func checkMessageArgs(def string, custom string) error {
+	defMsg, err := parseMessage(def)
+	if err != nil {
+		return errNotComplex // can't compare against an invalid default
+	}
+	customMsg, err := parseMessage(custom)
+	if err != nil {
+		return fmt.Errorf("invalid message format: %w", err)
+	}
+	if !defMsg.isComplex() && !customMsg.isComplex() {
+		return errNotComplex
+	}
+
+	defArgs := defMsg.args(nil)
+	customArgs := customMsg.args(nil)
+	for name, typ := range customArgs {
+		defTyp, ok := defArgs[name]
+		if !ok {
+			return fmt.Errorf("unknown argument {%s} in custom string", name)
+		}
+		if defTyp != typ && (isCaseType(defTyp) || isCaseType(typ)) {
+			return fmt.Errorf("argument {%s} should be used as %s, not %s", name, argTypeName(defTyp), argTypeName(typ))
+		}
+	}
+	for name := range defArgs {
+		if _, ok := customArgs[name]; !ok {
+			return fmt.Errorf("argument {%s} is not used", name)
+		}
+	}
+	return nil
+}
+
+func argTypeName(typ string) string {
+	if typ == "" {
+		return "a placeholder"
+	}
+	return "'" + typ + "'"
+}
+
+func isCaseType(typ string) bool {
+	return typ == "plural" || typ == "selectordinal" || typ == "select"
+}
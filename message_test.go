@@ -0,0 +1,91 @@
+package goloc
+
+import "testing"
+
+func TestTemplateFormat(t *testing.T) {
+	tests := []struct {
+		name string
+		src  string
+		lang string
+		args map[string]interface{}
+		want string
+	}{
+		{"plain", "Hello {1}", "en-GB", map[string]interface{}{"1": "Paul"}, "Hello Paul"},
+		{"missing arg", "Hello {1} and {2}", "en-GB", map[string]interface{}{"1": "Paul"}, "Hello Paul and {2}"},
+		{"plain apostrophe", "Impossible d'{1} le fichier", "fr", map[string]interface{}{"1": "ouvrir"}, "Impossible d'ouvrir le fichier"},
+		{"plain doubled apostrophe", "it''s {1}", "en-GB", map[string]interface{}{"1": "here"}, "it''s here"},
+		{"invalid falls back", "Hello {1", "en-GB", map[string]interface{}{"1": "Paul"}, "Hello {1"},
+		{"literal braces", "Use {{1}}", "en-GB", map[string]interface{}{"1": "v"}, "Use {v}"},
+		{"nested braces", `JSON {"k": {1}}`, "en-GB", map[string]interface{}{"1": "v"}, `JSON {"k": v}`},
+		{"stray braces", "} {1} {", "en-GB", map[string]interface{}{"1": "v"}, "} v {"},
+		{"number", "{1, number, integer} files", "en-GB", map[string]interface{}{"1": 2024}, "2,024 files"},
+		{"typed doubled apostrophe", "it''s {1, number, integer}", "en-GB", map[string]interface{}{"1": 3}, "it's 3"},
+		{"typed lone apostrophe", "l'an {1, number, integer}", "fr", map[string]interface{}{"1": 3}, "l'an 3"},
+		{"typed quoted brace", "'{'{1, number, integer}'}'", "en-GB", map[string]interface{}{"1": 3}, "{3}"},
+		{"plural one", "{1, plural, one {# file} other {# files}}", "en-GB", map[string]interface{}{"1": 1}, "1 file"},
+		{"plural other", "{1, plural, one {# file} other {# files}}", "en-GB", map[string]interface{}{"1": 1000}, "1,000 files"},
+		{"plural string", "{1, plural, one {# file} other {# files}}", "en-GB", map[string]interface{}{"1": "2"}, "2 files"},
+		{"plural exact", "{1, plural, =0 {no files} one {# file} other {# files}}", "en-GB", map[string]interface{}{"1": 0}, "no files"},
+		{"plural quoted hash", "{1, plural, other {'#' # files}}", "en-GB", map[string]interface{}{"1": 5}, "# 5 files"},
+		{"plural apostrophe", "{1, plural, other {it''s # files}}", "en-GB", map[string]interface{}{"1": 5}, "it's 5 files"},
+		{"plural offset", "{1, plural, offset:1 =0 {nobody} =1 {{2}} one {{2} and # other} other {{2} and # others}}", "en-GB",
+			map[string]interface{}{"1": 2, "2": "Paul"}, "Paul and 1 other"},
+		{"plural offset exact", "{1, plural, offset:1 =0 {nobody} =1 {{2}} one {{2} and # other} other {{2} and # others}}", "en-GB",
+			map[string]interface{}{"1": 1, "2": "Paul"}, "Paul"},
+		{"plural rules", "{1, plural, one {# fichier} other {# fichiers}}", "fr", map[string]interface{}{"1": 0}, "0 fichier"},
+		{"selectordinal", "{1, selectordinal, one {#st} two {#nd} few {#rd} other {#th}}", "en-GB", map[string]interface{}{"1": 23}, "23rd"},
+		{"selectordinal other", "{1, selectordinal, one {#st} two {#nd} few {#rd} other {#th}}", "en-GB", map[string]interface{}{"1": 11}, "11th"},
+		{"select", "{1, select, female {She} other {They}} joined", "en-GB", map[string]interface{}{"1": "female"}, "She joined"},
+		{"select other", "{1, select, female {She} other {They}} joined", "en-GB", map[string]interface{}{"1": "x"}, "They joined"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTemplate(tt.src).format(tt.lang, typedArgs(tt.args)); got != tt.want {
+				t.Errorf("format(%q) = %q, want %q", tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseMessageQuotes(t *testing.T) {
+	tests := []struct {
+		src     string
+		complex bool
+		text    string // text of the first node
+	}{
+		{"d'{1}", false, "d'"},
+		{"it''s {1}", false, "it''s "},
+		{"'{1}'", false, "'"},
+		{"it''s {1, number}", true, "it's "},
+		{"d'{1, number}", true, "d'"}, // quoting would leave no typed argument
+		{"'{'{1, number}", true, "{"},
+		{"l'an {1, plural, other {#}}", true, "l'an "},
+	}
+	for _, tt := range tests {
+		m, err := parseMessage(tt.src)
+		if err != nil {
+			t.Errorf("parseMessage(%q): %v", tt.src, err)
+			continue
+		}
+		if m.isComplex() != tt.complex {
+			t.Errorf("parseMessage(%q).isComplex() = %t, want %t", tt.src, m.isComplex(), tt.complex)
+		}
+		if len(m) == 0 || m[0].kind != nodeText || m[0].text != tt.text {
+			t.Errorf("parseMessage(%q) starts with %+v, want text %q", tt.src, m, tt.text)
+		}
+	}
+}
+
+func TestParseMessageErrors(t *testing.T) {
+	for _, src := range []string{
+		"Hello {1",
+		"Hello }",
+		"{1, plural, one {# file}}",
+		"{1, select, female {She}}",
+		"{1, plural, offset:x other {#}}",
+	} {
+		if _, err := parseMessage(src); err == nil {
+			t.Errorf("parseMessage(%q) succeeded, want an error", src)
+		}
+	}
+}
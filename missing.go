@@ -0,0 +1,91 @@
+package goloc
+
+import (
+	"expvar"
+	"fmt"
+	"sync"
+	"sync/atomic"
+)
+
+// MissingPolicy decides what a bundle returns for strings which aren't translated in any language of the fallback
+// chain.
+type MissingPolicy int
+
+const (
+	MissingEmpty  MissingPolicy = iota // return an empty string
+	MissingKey                         // return the translation key
+	MissingMarker                      // return a visible [[key]] marker
+	MissingPanic                       // panic; useful during development
+)
+
+// LangStats counts how often strings requested in a language had to be looked up elsewhere.
+type LangStats struct {
+	Misses    int64 // not found in any language
+	Fallbacks int64 // found in another language of the fallback chain
+}
+
+type langStats struct {
+	misses    int64
+	fallbacks int64
+}
+
+// stats returns the counters for lang, creating them if needed.
+func (b *Bundle) stats(lang string) *langStats {
+	if s, ok := b.langStats.Load(lang); ok {
+		return s.(*langStats)
+	}
+	s, _ := b.langStats.LoadOrStore(lang, &langStats{})
+	return s.(*langStats)
+}
+
+// Stats returns the miss and fallback counters of every requested language.
+func (b *Bundle) Stats() map[string]LangStats {
+	out := make(map[string]LangStats)
+	b.langStats.Range(func(k, v interface{}) bool {
+		s := v.(*langStats)
+		out[k.(string)] = LangStats{
+			Misses:    atomic.LoadInt64(&s.misses),
+			Fallbacks: atomic.LoadInt64(&s.fallbacks),
+		}
+		return true
+	})
+	return out
+}
+
+// PublishExpvar exports the bundle's Stats as an expvar variable with the given name. Like expvar.Publish, it panics
+// if the name is already in use.
+func (b *Bundle) PublishExpvar(name string) {
+	expvar.Publish(name, expvar.Func(func() interface{} {
+		return b.Stats()
+	}))
+}
+
+// missing handles a string which wasn't found in any language, according to the bundle's policy.
+func (b *Bundle) missing(lang string, trnlVal string) string {
+	if b.OnMissing != nil {
+		b.OnMissing(lang, trnlVal)
+	}
+	switch b.Missing {
+	case MissingKey:
+		return trnlVal
+	case MissingMarker:
+		return "[[" + trnlVal + "]]"
+	case MissingPanic:
+		panic(fmt.Sprintf("goloc: missing translation for '%s' in %s", trnlVal, lang))
+	}
+	return ""
+}
+
+// Stats returns the miss and fallback counters of the default bundle.
+func Stats() map[string]LangStats {
+	return std.Stats()
+}
+
+var publishOnce sync.Once
+
+// PublishExpvar exports the default bundle's Stats as the expvar variable "goloc". It is safe to call more than once.
+func PublishExpvar() {
+	publishOnce.Do(func() {
+		std.PublishExpvar("goloc")
+	})
+}
@@ -0,0 +1,52 @@
+package goloc
+
+import (
+	"go/ast"
+	"strings"
+)
+
+// SourceRef is a place where a string is used.
+type SourceRef struct {
+	Func string `xml:"func,attr,omitempty"` // package-qualified name of the enclosing function
+	Pos  string `xml:",chardata"`           // file:line, with the file named like modules
+}
+
+// translatorsPrefix starts comments which are passed on to translators, such as // TRANSLATORS: %s is a user name.
+const translatorsPrefix = "TRANSLATORS:"
+
+// notes returns the comments for translators in f, by the lines they apply to like directives. A note runs from the
+// prefix to the end of its comment block.
+func (l *Locer) notes(f *ast.File) map[int]*directive {
+	out := make(map[int]*directive)
+	for _, group := range f.Comments {
+		text := group.Text()
+		i := strings.Index(text, translatorsPrefix)
+		if i < 0 || i > 0 && text[i-1] != '\n' {
+			continue
+		}
+		note := strings.Join(strings.Fields(text[i+len(translatorsPrefix):]), " ")
+		if note == "" {
+			continue
+		}
+		d := &directive{value: note}
+		out[l.Fset.Position(group.Pos()).Line] = d
+		out[l.Fset.Position(group.End()).Line+1] = d
+	}
+	return out
+}
+
+// addRef records another use of the extracted string key in module, in every language. The note is kept unless the
+// string didn't have one.
+func addRef(module string, key string, hint keyHint) {
+	for lang := range newData {
+		v, ok := newData[lang][module][key]
+		if !ok {
+			continue
+		}
+		v.Refs = append(v.Refs, hint.ref)
+		if v.Note == "" {
+			v.Note = hint.note
+		}
+		newData[lang][module][key] = v
+	}
+}
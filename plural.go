@@ -0,0 +1,141 @@
+package goloc
+
+import (
+	"sync"
+
+	"golang.org/x/text/feature/plural"
+	"golang.org/x/text/language"
+)
+
+// Plural is a single CLDR plural form of a translated string.
+type Plural struct {
+	Form  string `xml:"form,attr"` // one of zero, one, two, few, many or other
+	Value string `xml:",chardata"`
+
+	tmpl *template // parsed Value, set when loaded
+}
+
+// pluralOrder is the CLDR ordering of all plural forms.
+var pluralOrder = []plural.Form{plural.Zero, plural.One, plural.Two, plural.Few, plural.Many, plural.Other}
+
+var pluralNames = map[plural.Form]string{
+	plural.Other: "other",
+	plural.Zero:  "zero",
+	plural.One:   "one",
+	plural.Two:   "two",
+	plural.Few:   "few",
+	plural.Many:  "many",
+}
+
+var pluralFormsCache sync.Map // canonical tag:[]string
+
+// PluralForms returns the CLDR plural forms used by lang, in CLDR order. Every language uses at least "other".
+func PluralForms(lang string) []string {
+	t := language.Make(lang)
+	if forms, ok := pluralFormsCache.Load(t.String()); ok {
+		return forms.([]string)
+	}
+
+	// x/text doesn't expose the forms of a language, so find them by sampling enough integers and decimals to hit
+	// every rule.
+	used := map[plural.Form]bool{}
+	for i := 0; i <= 1000; i++ {
+		used[plural.Cardinal.MatchPlural(t, i, 0, 0, 0, 0)] = true
+	}
+	for i := 0; i <= 20; i++ {
+		for f := 1; f <= 9; f++ {
+			used[plural.Cardinal.MatchPlural(t, i, 1, 1, f, f)] = true
+		}
+	}
+
+	var forms []string
+	for _, f := range pluralOrder {
+		if used[f] {
+			forms = append(forms, pluralNames[f])
+		}
+	}
+	pluralFormsCache.Store(t.String(), forms)
+	return forms
+}
+
+// pluralForm returns the name of the plural form lang uses for count.
+func pluralForm(lang string, count int) string {
+	if count < 0 {
+		count = -count
+	}
+	return pluralNames[plural.Cardinal.MatchPlural(language.Make(lang), count, 0, 0, 0, 0)]
+}
+
+// plural returns the value of the given plural form, if it has been translated.
+func (v Value) plural(form string) (string, bool) {
+	p, ok := v.pluralForm(form)
+	return p.Value, ok
+}
+
+// pluralForm returns the given plural form, if it has been translated.
+func (v Value) pluralForm(form string) (Plural, bool) {
+	for _, p := range v.Plurals {
+		if p.Form == form && p.Value != "" {
+			return p, true
+		}
+	}
+	return Plural{}, false
+}
+
+// template returns the parsed plural form, parsing it if it wasn't loaded by a bundle.
+func (p Plural) template() *template {
+	if p.tmpl != nil {
+		return p.tmpl
+	}
+	return newTemplate(p.Value)
+}
+
+// pluralSkeleton returns an untranslated plural form for every form lang needs, if def has plural forms.
+func pluralSkeleton(lang string, def Value) []Plural {
+	if len(def.Plurals) == 0 {
+		return nil
+	}
+	var ps []Plural
+	for _, f := range PluralForms(lang) {
+		ps = append(ps, Plural{Form: f})
+	}
+	return ps
+}
+
+// lookupPlural returns the best plural form of trnlVal for count, following the fallback chain. Languages which have
+// no plural forms for the string fall back to their plain value. The language used is also returned.
+func (b *Bundle) lookupPlural(lang string, trnlVal string, count int) (*template, string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range b.chain(lang) {
+		v := b.data[l][trnlVal]
+		if p, ok := v.pluralForm(pluralForm(l, count)); ok {
+			b.record(lang, l)
+			return p.template(), l
+		}
+		if p, ok := v.pluralForm("other"); ok {
+			b.record(lang, l)
+			return p.template(), l
+		}
+		if v.Value != "" {
+			b.record(lang, l)
+			return v.template(), l
+		}
+	}
+	b.record(lang, "")
+	return nil, lang
+}
+
+// TrnlPlural translates a string which has plural forms, picking the form the language uses for count. Arguments are
+// filled in from dataMap, as with Trnlf.
+func (b *Bundle) TrnlPlural(lang string, trnlVal string, count int, dataMap map[string]string) string {
+	t, l := b.lookupPlural(lang, trnlVal, count)
+	if t == nil {
+		return b.missing(lang, trnlVal)
+	}
+	return t.format(l, stringArgs(dataMap))
+}
+
+func TrnlPlural(lang string, trnlVal string, count int, dataMap map[string]string) string {
+	return std.TrnlPlural(lang, trnlVal, count, dataMap)
+}
@@ -0,0 +1,612 @@
+package goloc
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// ParseKeyMapping reads a key mapping for Rekey: an old key and its new key on each line, separated by white space.
+// Blank lines and lines starting with # are ignored.
+func ParseKeyMapping(r io.Reader) (map[string]string, error) {
+	mapping := make(map[string]string)
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 2 {
+			return nil, fmt.Errorf("line %d: expected an old key and a new key", n)
+		}
+		if newKey, ok := mapping[fields[0]]; ok && newKey != fields[1] {
+			return nil, fmt.Errorf("line %d: key %q is already renamed to %q", n, fields[0], newKey)
+		}
+		mapping[fields[0]] = fields[1]
+	}
+	return mapping, scanner.Err()
+}
+
+// Rekey renames translation keys as given by mapping, from old key to new key: in the goloc calls of the Go files
+// matching args, and in the translation files of every language. Ids and counters are kept, so nothing has to be
+// translated again. Nothing is written unless every change can be made.
+func (l *Locer) Rekey(args []string, mapping map[string]string) error {
+	r, err := l.newRekeyer(args)
+	if err != nil {
+		return err
+	}
+	if err := r.rename(mapping); err != nil {
+		return err
+	}
+	return r.commit()
+}
+
+// RekeyAll builds the key of every translation again with strategy, and renames them like Rekey. Keys given by
+// //goloc:key comments are kept.
+func (l *Locer) RekeyAll(args []string, strategy KeyStrategy) error {
+	k := &Locer{DefaultLang: l.DefaultLang, Keys: strategy}
+	if err := k.checkKeys(); err != nil {
+		return err
+	}
+	r, err := l.newRekeyer(args)
+	if err != nil {
+		return err
+	}
+	if err := r.rename(r.strategyMapping(k)); err != nil {
+		return err
+	}
+	return r.commit()
+}
+
+// Move renames the Go file from to to, along with its translation files in every language. Keys built from its name
+// are renamed like Rekey, in the Go files matching args as well as the moved file, and its Load call is updated.
+func (l *Locer) Move(args []string, from string, to string) error {
+	absFrom, err := filepath.Abs(from)
+	if err != nil {
+		return err
+	}
+	absTo, err := filepath.Abs(to)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(absTo); err == nil {
+		return fmt.Errorf("can't move %s to %s: it already exists", from, to)
+	}
+	r, err := l.newRekeyer(append(args, from))
+	if err != nil {
+		return err
+	}
+	if err := r.move(absFrom, absTo); err != nil {
+		return err
+	}
+	return r.commit()
+}
+
+// rekeyer holds the source and translation files being rekeyed, with their changes.
+type rekeyer struct {
+	l        *Locer
+	files    []*sourceFile
+	catalogs []*catalogFile
+	mapping  map[string]string // keys renamed, from old to new
+}
+
+// sourceFile is a Go file using translation keys.
+type sourceFile struct {
+	path   string
+	target string // path to write the file to
+	module string
+	src    []byte
+	uses   []keyUse
+	loads  []*ast.BasicLit // modules loaded by goloc.Load calls
+	edits  []edit
+}
+
+// keyUse is a translation key used by a goloc call.
+type keyUse struct {
+	lit      *ast.BasicLit
+	key      string
+	fn       string // package-qualified name of the enclosing function
+	explicit bool   // the key was given by a //goloc:key comment
+}
+
+// edit replaces the source between two offsets.
+type edit struct {
+	start, end int
+	text       string
+}
+
+// catalogFile is the translation file of a module in one language.
+type catalogFile struct {
+	path    string
+	target  string // path to write the file to
+	lang    string
+	module  string
+	data    Translation
+	changed bool
+}
+
+func (l *Locer) newRekeyer(args []string) (*rekeyer, error) {
+	r := &rekeyer{l: l}
+	var readErr error
+	err := l.Handle(args, func(f *ast.File, pkg *packages.Package) {
+		sf, err := l.sourceFile(f, pkg)
+		if err != nil {
+			if readErr == nil {
+				readErr = err
+			}
+			return
+		}
+		r.files = append(r.files, sf)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if readErr != nil {
+		return nil, readErr
+	}
+	if err := r.loadCatalogs(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// sourceFile reads f, and finds the translation keys and modules it uses.
+func (l *Locer) sourceFile(f *ast.File, pkg *packages.Package) (*sourceFile, error) {
+	fpath := l.Fset.File(f.Pos()).Name()
+	src, err := os.ReadFile(fpath)
+	if err != nil {
+		return nil, err
+	}
+	sf := &sourceFile{path: fpath, target: fpath, module: l.fileName(f.Pos()), src: src}
+	keyComments := l.directives(f, keyDirective)
+	for _, d := range f.Decls {
+		var fn string
+		if decl, ok := d.(*ast.FuncDecl); ok {
+			fn = funcKeyName(pkg.TypesInfo, pkg.PkgPath, decl)
+		}
+		ast.Inspect(d, func(n ast.Node) bool {
+			call, ok := n.(*ast.CallExpr)
+			if !ok {
+				return true
+			}
+			sel, ok := call.Fun.(*ast.SelectorExpr)
+			if !ok {
+				return true
+			}
+			if x, ok := sel.X.(*ast.Ident); !ok || x.Name != "goloc" {
+				return true
+			}
+			switch {
+			case isTrnlFunc(sel.Sel.Name) && len(call.Args) > 1:
+				if lit, key, ok := stringLit(call.Args[1]); ok {
+					explicit := l.directiveAt(keyComments, call.Pos()) == key
+					sf.uses = append(sf.uses, keyUse{lit: lit, key: key, fn: fn, explicit: explicit})
+				}
+			case sel.Sel.Name == "Load" && len(call.Args) == 1:
+				if lit, _, ok := stringLit(call.Args[0]); ok {
+					sf.loads = append(sf.loads, lit)
+				}
+			}
+			return true
+		})
+	}
+	return sf, nil
+}
+
+func stringLit(expr ast.Expr) (*ast.BasicLit, string, bool) {
+	lit, ok := expr.(*ast.BasicLit)
+	if !ok || lit.Kind != token.STRING {
+		return nil, "", false
+	}
+	s, err := strconv.Unquote(lit.Value)
+	return lit, s, err == nil
+}
+
+// replace records that lit has to be replaced by the string s.
+func (sf *sourceFile) replace(fset *token.FileSet, lit *ast.BasicLit, s string) {
+	sf.edits = append(sf.edits, edit{
+		start: fset.Position(lit.Pos()).Offset,
+		end:   fset.Position(lit.End()).Offset,
+		text:  strconv.Quote(s),
+	})
+}
+
+// edited returns the source with all the edits made.
+func (sf *sourceFile) edited() []byte {
+	sort.Slice(sf.edits, func(i, j int) bool { return sf.edits[i].start < sf.edits[j].start })
+	var buf bytes.Buffer
+	last := 0
+	for _, e := range sf.edits {
+		buf.Write(sf.src[last:e.start])
+		buf.WriteString(e.text)
+		last = e.end
+	}
+	buf.Write(sf.src[last:])
+	return buf.Bytes()
+}
+
+// loadCatalogs reads the translation files of every language.
+func (r *rekeyer) loadCatalogs() error {
+	dir := r.l.dir()
+	langs, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	// translation files are named after the module, without its extension
+	modules := make(map[string]string)
+	for _, sf := range r.files {
+		modules[strings.TrimSuffix(sf.module, path.Ext(sf.module))+".xml"] = sf.module
+	}
+
+	for _, d := range langs {
+		if !d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			continue
+		}
+		lang := d.Name()
+		langDir := filepath.Join(dir, lang)
+		err := filepath.WalkDir(langDir, func(fpath string, e fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if e.IsDir() || filepath.Ext(fpath) != ".xml" {
+				return nil
+			}
+			rel, err := filepath.Rel(langDir, fpath)
+			if err != nil {
+				return err
+			}
+			rel = filepath.ToSlash(rel)
+			module, ok := modules[rel]
+			if !ok {
+				module = strings.TrimSuffix(rel, ".xml") + ".go"
+			}
+			cf := &catalogFile{path: fpath, target: fpath, lang: lang, module: module}
+			data, err := os.ReadFile(fpath)
+			if err != nil {
+				return err
+			}
+			if err := xml.Unmarshal(data, &cf.data); err != nil {
+				return fmt.Errorf("failed to decode %s: %w", fpath, err)
+			}
+			r.catalogs = append(r.catalogs, cf)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// strategyMapping returns the keys built by k for every translation of the default language, by their current key.
+func (r *rekeyer) strategyMapping(k *Locer) map[string]string {
+	k.allLoaded = true // nothing to load: every key gets built again
+
+	uses := make(map[string]keyUse)
+	for _, sf := range r.files {
+		for _, use := range sf.uses {
+			if _, ok := uses[use.key]; !ok {
+				uses[use.key] = use
+			}
+		}
+	}
+	defaults := r.defaultCatalogs()
+	// explicit keys are kept, so no other string may get them
+	for _, cf := range defaults {
+		for _, row := range cf.data.Rows {
+			if uses[row.Name].explicit {
+				k.useKey(row.Name, dedupKey(rowText(row), row.Context))
+			}
+		}
+	}
+
+	mapping := make(map[string]string)
+	for _, cf := range defaults {
+		for _, row := range cf.data.Rows {
+			if _, done := mapping[row.Name]; done || row.Name == "" || uses[row.Name].explicit {
+				continue
+			}
+			text := rowText(row)
+			key := k.newKey(cf.module, row.Id, text, keyHint{fn: uses[row.Name].fn, context: row.Context})
+			k.useKey(key, dedupKey(text, row.Context))
+			mapping[row.Name] = key
+		}
+	}
+	return mapping
+}
+
+func (r *rekeyer) defaultCatalogs() []*catalogFile {
+	var out []*catalogFile
+	for _, cf := range r.catalogs {
+		if cf.lang == r.l.DefaultLang {
+			out = append(out, cf)
+		}
+	}
+	return out
+}
+
+// rowText returns the text of a translation, or its other plural form if it only has plural forms.
+func rowText(v Value) string {
+	if other, ok := v.plural("other"); ok && v.Value == "" {
+		return other
+	}
+	return v.Value
+}
+
+// rename renames keys as given by mapping, as long as no two strings end up with the same key.
+func (r *rekeyer) rename(mapping map[string]string) error {
+	r.mapping = make(map[string]string)
+	for oldKey, newKey := range mapping {
+		if oldKey != newKey {
+			r.mapping[oldKey] = newKey
+		}
+	}
+	renamed := func(key string) string {
+		if newKey, ok := r.mapping[key]; ok {
+			return newKey
+		}
+		return key
+	}
+
+	found := make(map[string]bool)
+	texts := make(map[string]string)
+	for _, cf := range r.defaultCatalogs() {
+		keys := make(map[string]bool)
+		for _, row := range cf.data.Rows {
+			if row.Name == "" {
+				continue
+			}
+			found[row.Name] = true
+			key := renamed(row.Name)
+			if keys[key] {
+				return fmt.Errorf("%s: more than one string would have the key %q", cf.module, key)
+			}
+			keys[key] = true
+			id := dedupKey(rowText(row), row.Context)
+			if text, ok := texts[key]; ok && text != id {
+				return fmt.Errorf("can't give the key %q to more than one string", key)
+			}
+			texts[key] = id
+		}
+	}
+	for _, sf := range r.files {
+		for _, use := range sf.uses {
+			found[use.key] = true
+		}
+	}
+	for oldKey := range r.mapping {
+		if !found[oldKey] {
+			Logger.Warnf("key %q isn't used anywhere", oldKey)
+		}
+	}
+
+	for _, cf := range r.catalogs {
+		for i, row := range cf.data.Rows {
+			newKey, ok := r.mapping[row.Name]
+			if !ok || row.Name == "" {
+				continue
+			}
+			if row.Comment == row.Name {
+				// the default language notes the key
+				cf.data.Rows[i].Comment = newKey
+			}
+			cf.data.Rows[i].Name = newKey
+			cf.changed = true
+		}
+	}
+	for _, sf := range r.files {
+		for _, use := range sf.uses {
+			if newKey, ok := r.mapping[use.key]; ok {
+				sf.replace(r.l.Fset, use.lit, newKey)
+			}
+		}
+	}
+	return nil
+}
+
+// move renames the source file at from, and the translation files of its module; keys built from the module name
+// are renamed to use the new one.
+func (r *rekeyer) move(from string, to string) error {
+	var sf *sourceFile
+	for _, f := range r.files {
+		if f.path == from {
+			sf = f
+		}
+	}
+	if sf == nil {
+		return fmt.Errorf("%s isn't part of a loaded package", from)
+	}
+	oldModule, newModule := sf.module, moduleName(to)
+	sf.target = to
+	for _, lit := range sf.loads {
+		if s, _ := strconv.Unquote(lit.Value); s == oldModule {
+			sf.replace(r.l.Fset, lit, newModule)
+		}
+	}
+
+	mapping := make(map[string]string)
+	for _, cf := range r.catalogs {
+		if cf.module != oldModule {
+			continue
+		}
+		fpath, err := moduleFile(cf.lang, newModule)
+		if err != nil {
+			return err
+		}
+		cf.target = filepath.Join(r.l.dir(), filepath.FromSlash(fpath))
+		if _, err := os.Stat(cf.target); err == nil {
+			return fmt.Errorf("can't move the translations of %s to %s: it already exists", oldModule, cf.target)
+		}
+		cf.module = newModule
+		for i := range cf.data.Rows {
+			row := &cf.data.Rows[i]
+			if n, ok := strings.CutPrefix(row.Name, oldModule+":"); ok {
+				mapping[row.Name] = newModule + ":" + n
+			}
+			for j, ref := range row.Refs {
+				if line, ok := strings.CutPrefix(ref.Pos, oldModule+":"); ok {
+					row.Refs[j].Pos = newModule + ":" + line
+				}
+			}
+		}
+	}
+	return r.rename(mapping)
+}
+
+// commit writes every changed file, or lists them if the Locer doesn't Apply changes. The renamed keys are printed
+// in the format read by ParseKeyMapping.
+func (r *rekeyer) commit() error {
+	var c changeSet
+	for _, sf := range r.files {
+		if len(sf.edits) == 0 && sf.target == sf.path {
+			continue
+		}
+		c.write(sf.target, sf.edited())
+		if sf.target != sf.path {
+			c.remove(sf.path)
+		}
+	}
+	for _, cf := range r.catalogs {
+		if !cf.changed && cf.target == cf.path {
+			continue
+		}
+		data, err := encodeTranslation(cf.data)
+		if err != nil {
+			return err
+		}
+		c.write(cf.target, data)
+		if cf.target != cf.path {
+			c.remove(cf.path)
+		}
+	}
+
+	oldKeys := make([]string, 0, len(r.mapping))
+	for k := range r.mapping {
+		oldKeys = append(oldKeys, k)
+	}
+	sort.Strings(oldKeys)
+	for _, k := range oldKeys {
+		fmt.Println(k + "\t" + r.mapping[k])
+	}
+
+	if !r.l.Apply {
+		for _, w := range c.writes {
+			Logger.Info("would write " + w.path)
+		}
+		for _, fpath := range c.removes {
+			Logger.Info("would remove " + fpath)
+		}
+		return nil
+	}
+	return c.commit()
+}
+
+func encodeTranslation(t Translation) ([]byte, error) {
+	buf := bytes.NewBuffer([]byte{})
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(buf)
+	enc.Indent("", "    ")
+	if err := enc.Encode(t); err != nil {
+		return nil, err
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// changeSet holds the new contents of files, so that they can be written once every change is known.
+type changeSet struct {
+	writes  []fileWrite
+	removes []string
+}
+
+type fileWrite struct {
+	path string
+	data []byte
+}
+
+func (c *changeSet) write(fpath string, data []byte) {
+	c.writes = append(c.writes, fileWrite{path: fpath, data: data})
+}
+
+func (c *changeSet) remove(fpath string) {
+	c.removes = append(c.removes, fpath)
+}
+
+// commit writes every file to a temporary file next to it, then renames them all into place, and removes the files
+// which were moved. If any temporary file can't be written, no file is changed.
+func (c *changeSet) commit() error {
+	tmps := make([]string, len(c.writes))
+	cleanup := func() {
+		for _, tmp := range tmps {
+			if tmp != "" {
+				os.Remove(tmp)
+			}
+		}
+	}
+	for i, w := range c.writes {
+		tmp, err := writeTemp(w.path, w.data)
+		if err != nil {
+			cleanup()
+			return err
+		}
+		tmps[i] = tmp
+	}
+	for i, w := range c.writes {
+		if err := os.Rename(tmps[i], w.path); err != nil {
+			cleanup()
+			return err
+		}
+		tmps[i] = ""
+	}
+	for _, fpath := range c.removes {
+		if err := os.Remove(fpath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTemp writes data to a temporary file in the directory of fpath, with the permissions of fpath if it exists.
+func writeTemp(fpath string, data []byte) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(fpath), 0755); err != nil {
+		return "", err
+	}
+	perm := os.FileMode(0644)
+	if fi, err := os.Stat(fpath); err == nil {
+		perm = fi.Mode().Perm()
+	}
+	f, err := os.CreateTemp(filepath.Dir(fpath), "."+filepath.Base(fpath)+".*.tmp")
+	if err != nil {
+		return "", err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Chmod(perm)
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
@@ -0,0 +1,258 @@
+package goloc
+
+import (
+	"encoding/xml"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const rekeySource = `package m
+
+import "strings"
+
+type Bot struct{}
+
+func (b *Bot) Send(s string) {}
+
+func getLang(u string) string { return strings.ToLower(u) }
+
+func Greet(b *Bot, u string) {
+	b.Send("Hello")
+	b.Send("Goodbye")
+	//goloc:key farewell
+	b.Send("See you")
+}
+`
+
+// rekeyModule returns a module whose strings have been extracted, with a German translation of each of them.
+func rekeyModule(t *testing.T) string {
+	t.Helper()
+	dir := testModule(t, map[string]string{"a.go": rekeySource})
+	extract(t, dir, nil)
+	de := readCatalog(t, filepath.Join(dir, "trans", "en-GB", "a.xml"))
+	for i := range de.Rows {
+		de.Rows[i].Value = "de " + de.Rows[i].Value
+		de.Rows[i].Comment = de.Rows[i].Name
+	}
+	data, err := encodeTranslation(de)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeTestFile(t, filepath.Join(dir, "trans", "de", "a.xml"), string(data))
+	return dir
+}
+
+func readCatalog(t *testing.T, fpath string) Translation {
+	t.Helper()
+	var tr Translation
+	if err := xml.Unmarshal([]byte(readTestFile(t, fpath)), &tr); err != nil {
+		t.Fatal(err)
+	}
+	return tr
+}
+
+// catalogRows returns the values of the rows of the catalog at fpath, by name.
+func catalogRows(t *testing.T, fpath string) map[string]string {
+	t.Helper()
+	rows := make(map[string]string)
+	for _, row := range readCatalog(t, fpath).Rows {
+		rows[row.Name] = row.Value
+	}
+	return rows
+}
+
+// snapshot returns the contents of every file under dir, by path relative to it.
+func snapshot(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	files := make(map[string]string)
+	err := filepath.WalkDir(dir, func(fpath string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		rel, _ := filepath.Rel(dir, fpath)
+		files[filepath.ToSlash(rel)] = readTestFile(t, fpath)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return files
+}
+
+func TestParseKeyMapping(t *testing.T) {
+	mapping, err := ParseKeyMapping(strings.NewReader("# renames\na.go:1 greeting\n\n  a.go:2\tfarewell  \na.go:1 greeting\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"a.go:1": "greeting", "a.go:2": "farewell"}
+	if !reflect.DeepEqual(mapping, want) {
+		t.Errorf("got %v, want %v", mapping, want)
+	}
+
+	for _, s := range []string{"a.go:1\n", "a.go:1 b c\n", "a.go:1 b\na.go:1 c\n"} {
+		if _, err := ParseKeyMapping(strings.NewReader(s)); err == nil {
+			t.Errorf("ParseKeyMapping(%q) succeeded, want an error", s)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	dir := rekeyModule(t)
+	l := newTestLocer(t, dir)
+	if err := l.Rekey([]string{dir}, map[string]string{"a.go:1": "greeting"}); err != nil {
+		t.Fatal(err)
+	}
+
+	wantLines(t, readTestFile(t, filepath.Join(dir, "a.go")),
+		`b.Send(goloc.Trnl(lang, "greeting"))`,
+		`b.Send(goloc.Trnl(lang, "a.go:2"))`,
+		`b.Send(goloc.Trnl(lang, "farewell"))`,
+	)
+	en := readCatalog(t, filepath.Join(dir, "trans", "en-GB", "a.xml"))
+	if row := en.Rows[0]; row.Name != "greeting" || row.Id != 1 || row.Value != "Hello" || row.Comment != "greeting" {
+		t.Errorf("en-GB row = %+v, want greeting with id 1", row)
+	}
+	if en.Counter != 3 {
+		t.Errorf("en-GB counter = %d, want 3", en.Counter)
+	}
+	de := catalogRows(t, filepath.Join(dir, "trans", "de", "a.xml"))
+	want := map[string]string{"greeting": "de Hello", "a.go:2": "de Goodbye", "farewell": "de See you"}
+	if !reflect.DeepEqual(de, want) {
+		t.Errorf("de rows = %v, want %v", de, want)
+	}
+}
+
+func TestRekeyAll(t *testing.T) {
+	dir := rekeyModule(t)
+	l := newTestLocer(t, dir)
+	if err := l.RekeyAll([]string{dir}, KeySlug); err != nil {
+		t.Fatal(err)
+	}
+
+	// keys given by //goloc:key comments are kept.
+	wantLines(t, readTestFile(t, filepath.Join(dir, "a.go")),
+		`b.Send(goloc.Trnl(lang, "hello"))`,
+		`b.Send(goloc.Trnl(lang, "goodbye"))`,
+		`b.Send(goloc.Trnl(lang, "farewell"))`,
+	)
+	for _, lang := range []string{"en-GB", "de"} {
+		rows := catalogRows(t, filepath.Join(dir, "trans", lang, "a.xml"))
+		for _, key := range []string{"hello", "goodbye", "farewell"} {
+			if _, ok := rows[key]; !ok {
+				t.Errorf("%s is missing %q: %v", lang, key, rows)
+			}
+		}
+	}
+
+	if err := l.RekeyAll([]string{dir}, "nope"); err == nil {
+		t.Error("RekeyAll with an unknown strategy succeeded")
+	}
+}
+
+func TestRekeyCollisions(t *testing.T) {
+	tests := map[string]map[string]string{
+		"same new key":      {"a.go:1": "x", "a.go:2": "x"},
+		"another's key":     {"a.go:1": "a.go:2"},
+		"explicit key":      {"a.go:2": "farewell"},
+		"swap with a clash": {"a.go:1": "a.go:2", "farewell": "a.go:1"},
+	}
+	for name, mapping := range tests {
+		t.Run(name, func(t *testing.T) {
+			dir := rekeyModule(t)
+			before := snapshot(t, dir)
+			l := newTestLocer(t, dir)
+			if err := l.Rekey([]string{dir}, mapping); err == nil {
+				t.Fatal("rekey succeeded, want an error")
+			}
+			if after := snapshot(t, dir); !reflect.DeepEqual(after, before) {
+				t.Error("a failed rekey changed files")
+			}
+		})
+	}
+
+	// swapping two keys is fine, since no two strings have the same key in the end.
+	dir := rekeyModule(t)
+	l := newTestLocer(t, dir)
+	if err := l.Rekey([]string{dir}, map[string]string{"a.go:1": "a.go:2", "a.go:2": "a.go:1"}); err != nil {
+		t.Fatal(err)
+	}
+	rows := catalogRows(t, filepath.Join(dir, "trans", "en-GB", "a.xml"))
+	if rows["a.go:1"] != "Goodbye" || rows["a.go:2"] != "Hello" {
+		t.Errorf("after swapping, rows = %v", rows)
+	}
+}
+
+func TestMove(t *testing.T) {
+	dir := rekeyModule(t)
+	l := newTestLocer(t, dir)
+	if err := l.Move([]string{dir}, filepath.Join(dir, "a.go"), filepath.Join(dir, "sub", "b.go")); err != nil {
+		t.Fatal(err)
+	}
+
+	files := snapshot(t, dir)
+	for _, gone := range []string{"a.go", "trans/en-GB/a.xml", "trans/de/a.xml"} {
+		if _, ok := files[gone]; ok {
+			t.Errorf("%s wasn't moved", gone)
+		}
+	}
+	wantLines(t, files["sub/b.go"],
+		`goloc.Load("sub/b.go")`,
+		`b.Send(goloc.Trnl(lang, "sub/b.go:1"))`,
+		`b.Send(goloc.Trnl(lang, "sub/b.go:2"))`,
+		`b.Send(goloc.Trnl(lang, "farewell"))`,
+	)
+	en := readCatalog(t, filepath.Join(dir, "trans", "en-GB", "sub", "b.xml"))
+	if row := en.Rows[0]; row.Name != "sub/b.go:1" || row.Id != 1 || len(row.Refs) != 1 || row.Refs[0].Pos != "sub/b.go:12" {
+		t.Errorf("en-GB row = %+v, want sub/b.go:1 used at sub/b.go:12", row)
+	}
+	de := catalogRows(t, filepath.Join(dir, "trans", "de", "sub", "b.xml"))
+	if de["sub/b.go:2"] != "de Goodbye" {
+		t.Errorf("de rows = %v", de)
+	}
+
+	// nothing is moved over an existing file.
+	writeTestFile(t, filepath.Join(dir, "c.go"), "package m\n")
+	before := snapshot(t, dir)
+	if err := l.Move([]string{dir}, filepath.Join(dir, "sub", "b.go"), filepath.Join(dir, "c.go")); err == nil {
+		t.Error("move over an existing file succeeded")
+	}
+	if after := snapshot(t, dir); !reflect.DeepEqual(after, before) {
+		t.Error("a failed move changed files")
+	}
+}
+
+func TestChangeSetCommit(t *testing.T) {
+	dir := t.TempDir()
+	a := filepath.Join(dir, "a.txt")
+	writeTestFile(t, a, "old")
+	blocker := filepath.Join(dir, "blocker")
+	writeTestFile(t, blocker, "not a directory")
+
+	// the second file can't be written, since its directory is a file: neither is changed.
+	var c changeSet
+	c.write(a, []byte("new"))
+	c.write(filepath.Join(blocker, "b.txt"), []byte("new"))
+	c.remove(blocker)
+	if err := c.commit(); err == nil {
+		t.Fatal("commit succeeded, want an error")
+	}
+	want := map[string]string{"a.txt": "old", "blocker": "not a directory"}
+	if got := snapshot(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("after a failed commit, files = %v, want %v", got, want)
+	}
+
+	c = changeSet{}
+	c.write(a, []byte("new"))
+	c.write(filepath.Join(dir, "sub", "b.txt"), []byte("b"))
+	c.remove(blocker)
+	if err := c.commit(); err != nil {
+		t.Fatal(err)
+	}
+	want = map[string]string{"a.txt": "new", "sub/b.txt": "b"}
+	if got := snapshot(t, dir); !reflect.DeepEqual(got, want) {
+		t.Errorf("after commit, files = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,206 @@
+package goloc
+
+import (
+	"errors"
+	"hash/fnv"
+	"io/fs"
+	"reflect"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// loader is a load call made on a bundle, which Reload replays to build a fresh catalog.
+type loader struct {
+	fsys   fs.FS
+	kind   string // the Load function called, such as LoadFS
+	lang   string
+	module string
+	load   func(b *Bundle) error
+	errs   string // the errors reported by the last run, if any
+}
+
+// same reports whether l and o load the same files.
+func (l loader) same(o loader) bool {
+	return l.kind == o.kind && l.lang == o.lang && l.module == o.module && sameFS(l.fsys, o.fsys)
+}
+
+// remember runs load, and records it so that Reload can run it again. Loads are recorded even if they report errors,
+// since the valid rows they found are part of the catalog. Loads of the same files are only recorded once.
+func (b *Bundle) remember(l loader) error {
+	err := l.load(b)
+	l.errs = errString(err)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, x := range b.loaders {
+		if x.same(l) {
+			b.loaders[i].errs = l.errs
+			return err
+		}
+	}
+	b.loaders = append(b.loaders, l)
+	return err
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
+
+// Reload reads every translation file loaded so far again, validates them, and swaps in the new catalog atomically;
+// translations in progress see either the old catalog or the new one, never a mix. If anything fails to load or
+// validate in a way it didn't before, the old catalog is kept and the errors are returned. Errors which a load already
+// reported, such as a module outside of the translation directory, don't stop the reload.
+func (b *Bundle) Reload() error {
+	b.reloadMu.Lock()
+	defer b.reloadMu.Unlock()
+
+	b.mu.RLock()
+	loaders := append([]loader(nil), b.loaders...)
+	b.mu.RUnlock()
+	if len(loaders) == 0 {
+		return errors.New("nothing has been loaded, so there is nothing to reload")
+	}
+
+	fresh := NewBundle(b.defaultLang())
+	results := make([]string, 0, len(loaders))
+	var errs LoadErrors
+	replay := func(l loader) {
+		err := l.load(fresh)
+		if errString(err) != l.errs {
+			errs.add(err)
+		}
+		results = append(results, errString(err))
+	}
+	for _, l := range loaders {
+		replay(l)
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	// anything loaded while we were busy has to be part of the new catalog too.
+	for _, l := range b.loaders[len(loaders):] {
+		replay(l)
+	}
+	if err := errs.err(); err != nil {
+		return err
+	}
+	for i := range b.loaders {
+		b.loaders[i].errs = results[i]
+	}
+	b.data = fresh.data
+	b.dataCount = fresh.dataCount
+	b.languages = nil
+	b.cache = &langCache{}
+	return nil
+}
+
+// Watch polls the translation files every interval, and reloads the bundle whenever one of them changes. Reload
+// errors are passed to onErr, or logged if onErr is nil; the old catalog stays in use until the files are fixed.
+// Call the returned function to stop watching.
+func (b *Bundle) Watch(interval time.Duration, onErr func(error)) (stop func()) {
+	if onErr == nil {
+		onErr = b.logLoadErr
+	}
+
+	// taken before returning, so that changes made right after Watch are seen.
+	last := b.fingerprint()
+	done := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			curr := b.fingerprint()
+			if curr == last {
+				continue
+			}
+			// only retry failed reloads once something changes again
+			last = curr
+			if err := b.Reload(); err != nil {
+				onErr(err)
+			}
+		}
+	}()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() { close(done) })
+	}
+}
+
+// fingerprint hashes the name, size and modification time of every file in the filesystems loaded from.
+func (b *Bundle) fingerprint() uint64 {
+	b.mu.RLock()
+	var fileSystems []fs.FS
+	for _, l := range b.loaders {
+		if !containsFS(fileSystems, l.fsys) {
+			fileSystems = append(fileSystems, l.fsys)
+		}
+	}
+	b.mu.RUnlock()
+
+	h := fnv.New64a()
+	for _, fsys := range fileSystems {
+		_ = fs.WalkDir(fsys, ".", func(fpath string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil // missing files just change the hash
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			h.Write([]byte(fpath + "\x00" + strconv.FormatInt(info.Size(), 10) + "\x00" +
+				strconv.FormatInt(info.ModTime().UnixNano(), 10) + "\x00"))
+			return nil
+		})
+	}
+	return h.Sum64()
+}
+
+// containsFS reports whether fsys is in fileSystems.
+func containsFS(fileSystems []fs.FS, fsys fs.FS) bool {
+	for _, x := range fileSystems {
+		if sameFS(x, fsys) {
+			return true
+		}
+	}
+	return false
+}
+
+// sameFS reports whether x and y are the same filesystem. Maps such as fstest.MapFS are the same if they're the same
+// map; other filesystems which can't be compared are never considered the same.
+func sameFS(x fs.FS, y fs.FS) bool {
+	t := reflect.TypeOf(x)
+	switch {
+	case t != reflect.TypeOf(y):
+		return false
+	case t.Comparable():
+		return x == y
+	case t.Kind() == reflect.Map:
+		return reflect.ValueOf(x).UnsafePointer() == reflect.ValueOf(y).UnsafePointer()
+	}
+	return false
+}
+
+// Reload reloads the default bundle.
+func Reload() error {
+	return std.Reload()
+}
+
+// Watch reloads the default bundle whenever its translation files change.
+func Watch(interval time.Duration, onErr func(error)) (stop func()) {
+	return std.Watch(interval, onErr)
+}
@@ -0,0 +1,138 @@
+package goloc
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+// moduleXML returns a translation file holding a single row named a:1.
+func moduleXML(value string) []byte {
+	return []byte(`<?xml version="1.0" encoding="UTF-8"?>
+<translation>
+    <Rows id="1" name="a:1">
+        <value>` + value + `</value>
+    </Rows>
+    <Counter>1</Counter>
+</translation>
+`)
+}
+
+func TestReload(t *testing.T) {
+	fsys := fstest.MapFS{
+		"en-GB/a.xml": {Data: moduleXML("Hello {1}")},
+		"de/a.xml":    {Data: moduleXML("Hallo {1}")},
+	}
+	b := NewBundle("en-GB")
+	if err := b.LoadFSE(fsys, "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	fsys["de/a.xml"] = &fstest.MapFile{Data: moduleXML("Guten Tag {1}")}
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Trnl("de", "a:1"); got != "Guten Tag {1}" {
+		t.Errorf("after reload, de = %q, want %q", got, "Guten Tag {1}")
+	}
+
+	// a file which breaks keeps the old catalog.
+	fsys["de/a.xml"] = &fstest.MapFile{Data: []byte("<translation>")}
+	if err := b.Reload(); err == nil {
+		t.Error("reload of a broken file succeeded")
+	}
+	if got := b.Trnl("de", "a:1"); got != "Guten Tag {1}" {
+		t.Errorf("after failed reload, de = %q, want %q", got, "Guten Tag {1}")
+	}
+}
+
+func TestReloadKeepsLoadsWithErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"en-GB/a.xml": {Data: moduleXML("Hello {1}")},
+		"de/a.xml":    {Data: moduleXML("Hallo {2}")},
+	}
+	b := NewBundle("en-GB")
+	if err := b.LoadFSE(fsys, "a"); err == nil {
+		t.Fatal("load of a bad placeholder succeeded")
+	}
+	if err := b.LoadFSE(fsys, "../x"); err == nil {
+		t.Fatal("load outside of the translation directory succeeded")
+	}
+
+	// errors which were already reported don't stop the reload, and don't drop the modules which had them.
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Trnl("en-GB", "a:1"); got != "Hello {1}" {
+		t.Errorf("after reload, en-GB = %q, want %q", got, "Hello {1}")
+	}
+
+	fsys["de/a.xml"] = &fstest.MapFile{Data: moduleXML("Hallo {1}")}
+	if err := b.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if got := b.Trnl("de", "a:1"); got != "Hallo {1}" {
+		t.Errorf("after fixing de, de = %q, want %q", got, "Hallo {1}")
+	}
+}
+
+func TestReloadRemembersLoadsOnce(t *testing.T) {
+	fsys := fstest.MapFS{"en-GB/a.xml": {Data: moduleXML("Hello")}}
+	b := NewBundle("en-GB")
+	for i := 0; i < 100; i++ {
+		b.LoadFS(fsys, "a")
+	}
+	if len(b.loaders) != 1 {
+		t.Errorf("got %d loaders, want 1", len(b.loaders))
+	}
+}
+
+func TestReloadNothingLoaded(t *testing.T) {
+	if err := NewBundle("en-GB").Reload(); err == nil {
+		t.Error("reload of an empty bundle succeeded")
+	}
+}
+
+func TestWatch(t *testing.T) {
+	dir := t.TempDir()
+	fpath := filepath.Join(dir, "en-GB", "a.xml")
+	if err := os.MkdirAll(filepath.Dir(fpath), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(fpath, moduleXML("Hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	b := NewBundle("en-GB")
+	if err := b.LoadFSE(os.DirFS(dir), "a"); err != nil {
+		t.Fatal(err)
+	}
+
+	errs := make(chan error, 10)
+	stop := b.Watch(5*time.Millisecond, func(err error) { errs <- err })
+	defer stop()
+
+	if err := os.WriteFile(fpath, moduleXML("Hello again"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for b.Trnl("en-GB", "a:1") != "Hello again" {
+		if time.Now().After(deadline) {
+			t.Fatalf("watch didn't reload: got %q", b.Trnl("en-GB", "a:1"))
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := os.WriteFile(fpath, []byte("<translation>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case <-errs:
+	case <-time.After(5 * time.Second):
+		t.Fatal("watch didn't report the broken file")
+	}
+	if got := b.Trnl("en-GB", "a:1"); got != "Hello again" {
+		t.Errorf("after a broken file, got %q, want %q", got, "Hello again")
+	}
+}
@@ -0,0 +1,190 @@
+package goloc
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"go/types"
+	"strconv"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// DefaultLangExpr is the expression assigned to the injected lang variable when Locer.LangExpr is empty.
+const DefaultLangExpr = "getLang(u)"
+
+// langSource is where a generated translation call gets its language from.
+type langSource struct {
+	name   string // variable holding the language, or the context
+	isCtx  bool   // name is a context.Context, so the T functions are called
+	inject bool   // name has to be declared at the start of the function
+}
+
+// langSource picks the language of a translation call at pos, inside the function fn. A string lang variable in scope
+// is used as is; otherwise a context.Context in scope is passed to the T functions. When neither exists, a lang
+// variable has to be injected into fn, or a function enclosing it; see injectLangs. In Context mode, a context is preferred over a lang variable.
+func (l *Locer) langSource(pkg *packages.Package, pos token.Pos, fn *ast.FuncType) langSource {
+	var scope *types.Scope
+	if pkg.Types != nil {
+		scope = pkg.Types.Scope().Innermost(pos)
+	}
+	var ctx string
+	if scope != nil {
+		ctx = contextInScope(pkg.Types, scope, pos)
+	}
+	if ctx != "" && l.Context {
+		return langSource{name: ctx, isCtx: true}
+	}
+	if scope != nil {
+		if _, obj := scope.LookupParent("lang", pos); isVarOrConst(obj) && isStringType(obj.Type()) {
+			return langSource{name: "lang"}
+		}
+	}
+	if ctx != "" {
+		return langSource{name: ctx, isCtx: true}
+	}
+	return langSource{name: injectName(pkg.TypesInfo, fn), inject: true}
+}
+
+// langUse is a generated translation call which reads an injected lang variable.
+type langUse struct {
+	funcs []*ast.FuncType // functions enclosing the call, innermost last
+	lang  *ast.Ident      // the language argument of the call
+}
+
+func newLangUse(funcs []*ast.FuncType, call *ast.CallExpr) langUse {
+	return langUse{funcs: append([]*ast.FuncType(nil), funcs...), lang: call.Args[0].(*ast.Ident)}
+}
+
+// injectLangs picks the functions to declare a lang variable in, in the order they were first needed, and names the
+// language arguments of uses after their variable. Each function using a lang variable directly gets one, and calls
+// in closures use the variable of the outermost enclosing function which has one, rather than declaring their own.
+// Since the name of a variable is never declared in any scope nested in its function, it can't be shadowed there.
+func injectLangs(info *types.Info, uses []langUse) ([]*ast.FuncType, map[*ast.FuncType]string) {
+	direct := make(map[*ast.FuncType]bool)
+	for _, u := range uses {
+		direct[u.funcs[len(u.funcs)-1]] = true
+	}
+	var order []*ast.FuncType
+	names := make(map[*ast.FuncType]string)
+	for _, u := range uses {
+		fn := u.funcs[len(u.funcs)-1]
+		for _, outer := range u.funcs {
+			if direct[outer] {
+				fn = outer
+				break
+			}
+		}
+		if _, ok := names[fn]; !ok {
+			names[fn] = injectName(info, fn)
+			order = append(order, fn)
+		}
+		u.lang.Name = names[fn]
+	}
+	return order, names
+}
+
+// injectName picks the name of the lang variable injected at the start of fn: lang, unless that would clash with or
+// hide another variable, in which case a number is appended. The name is the same for every call in fn.
+func injectName(info *types.Info, fn *ast.FuncType) string {
+	var scope *types.Scope
+	if info != nil && fn != nil {
+		scope = info.Scopes[fn]
+	}
+	name := "lang"
+	for i := 2; scope != nil && (declaredIn(scope, name) || hasParent(scope.Parent(), name)); i++ {
+		name = "lang" + strconv.Itoa(i)
+	}
+	return name
+}
+
+// declaredIn reports whether name is declared in scope, or any scope nested in it.
+func declaredIn(scope *types.Scope, name string) bool {
+	if scope.Lookup(name) != nil {
+		return true
+	}
+	for i := 0; i < scope.NumChildren(); i++ {
+		if declaredIn(scope.Child(i), name) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasParent reports whether name is visible in scope from any enclosing scope.
+func hasParent(scope *types.Scope, name string) bool {
+	_, obj := scope.LookupParent(name, token.NoPos)
+	return obj != nil
+}
+
+// isStringType reports whether t is a string, or couldn't be resolved.
+func isStringType(t types.Type) bool {
+	b, ok := t.Underlying().(*types.Basic)
+	return ok && (b.Info()&types.IsString != 0 || b.Kind() == types.Invalid)
+}
+
+// inFunc reports whether pos is inside a function, rather than at package level where no language is available.
+func inFunc(pkg *types.Package, pos token.Pos) bool {
+	if pkg == nil {
+		return false
+	}
+	scope := pkg.Scope().Innermost(pos)
+	return scope != nil && scope != pkg.Scope() && scope.Parent() != pkg.Scope()
+}
+
+func isVarOrConst(obj types.Object) bool {
+	switch obj.(type) {
+	case *types.Var, *types.Const:
+		return true
+	}
+	return false
+}
+
+// contextInScope returns the name of a context.Context variable or parameter visible at pos, ignoring package-level
+// variables.
+func contextInScope(pkg *types.Package, scope *types.Scope, pos token.Pos) string {
+	for s := scope; s != nil && s != pkg.Scope(); s = s.Parent() {
+		for _, name := range s.Names() {
+			v, ok := s.Lookup(name).(*types.Var)
+			if !ok || !isContext(v.Type()) {
+				continue
+			}
+			// make sure it's declared before pos, and isn't shadowed
+			if _, obj := scope.LookupParent(name, pos); obj == v {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func isContext(t types.Type) bool {
+	named, ok := t.(*types.Named)
+	if !ok {
+		return false
+	}
+	obj := named.Obj()
+	return obj.Pkg() != nil && obj.Pkg().Path() == "context" && obj.Name() == "Context"
+}
+
+// langExpr returns the expression assigned to injected lang variables, checked and formatted. It's returned as a
+// single identifier, since parsed nodes would carry positions from another file set.
+func (l *Locer) langExpr() (*ast.Ident, error) {
+	src := l.LangExpr
+	if src == "" {
+		src = DefaultLangExpr
+	}
+	fset := token.NewFileSet()
+	expr, err := parser.ParseExprFrom(fset, "", src, 0)
+	if err != nil {
+		return nil, fmt.Errorf("invalid lang expression %q: %w", src, err)
+	}
+	buf := bytes.NewBuffer([]byte{})
+	if err := printer.Fprint(buf, fset, expr); err != nil {
+		return nil, err
+	}
+	return &ast.Ident{Name: buf.String()}, nil
+}
@@ -2,167 +2,676 @@ package goloc
 
 import (
 	"encoding/xml"
+	"errors"
 	"fmt"
-	"io/ioutil"
+	"io/fs"
 	"os"
 	"path"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 
 	"go.uber.org/zap"
 )
 
-var data = make(map[string]map[string]Value)
-var dataCount = make(map[string]int)
-var languages []string
 var DefaultLang = "en-GB"
 var Logger *zap.SugaredLogger
 
-func Trnl(lang string, trnlVal string) string {
-	v, ok := data[lang][trnlVal]
-	if !ok || v.Value == "" {
-		return data[DefaultLang][trnlVal].Value
+// TranslationDir is the directory translations are loaded from by bundles which do not set their own.
+var TranslationDir = "trans"
+
+// std is the bundle used by all the package level functions.
+var std = NewBundle("")
+
+// Bundle holds a catalog of loaded translations. It is safe for concurrent use, so modules can be loaded while other
+// goroutines are translating.
+type Bundle struct {
+	// DefaultLang is the language used when a string is missing from the requested language.
+	// If empty, the package level DefaultLang is used.
+	DefaultLang string
+	// Logger is used to report loading errors. If nil, the package level Logger is used, and if that isn't set either,
+	// nothing is logged.
+	Logger *zap.SugaredLogger
+	// Dir is the translation directory used by the loaders which do not take an fs.FS.
+	// If empty, the package level TranslationDir is used.
+	Dir string
+	// Fallbacks lists explicit languages to try before the default language, such as "gsw": {"de"}. These are
+	// followed in addition to the BCP 47 parents of a language (pt-BR -> pt). Must not be modified after the bundle
+	// is in use.
+	Fallbacks map[string][]string
+	// Missing decides what is returned for strings which aren't translated in any language of the fallback chain.
+	Missing MissingPolicy
+	// OnMissing, if set, is called with every string which isn't translated in any language of the fallback chain.
+	OnMissing func(lang string, trnlVal string)
+	// LangParam and LangCookie name the query parameter and cookie which Negotiate checks for a language.
+	// Both default to "lang".
+	LangParam  string
+	LangCookie string
+
+	mu        sync.RWMutex
+	data      map[string]map[string]Value // lang:(name:Value)
+	dataCount map[string]int              // module:counter
+	languages []string                    // sorted list of loaded languages; nil when outdated
+	cache     *langCache                  // fallback chains and matcher for the loaded languages
+	langStats sync.Map                    // requested lang:*langStats
+	loaders   []loader                    // every load call made, to be replayed by Reload
+	reloadMu  sync.Mutex                  // serialises reloads
+}
+
+// NewBundle returns an empty bundle which falls back to defLang.
+func NewBundle(defLang string) *Bundle {
+	return &Bundle{
+		DefaultLang: defLang,
+		data:        make(map[string]map[string]Value),
+		dataCount:   make(map[string]int),
+		cache:       &langCache{},
+	}
+}
+
+// DefaultBundle returns the bundle used by the package level functions.
+func DefaultBundle() *Bundle {
+	return std
+}
+
+func (b *Bundle) defaultLang() string {
+	if b.DefaultLang != "" {
+		return b.DefaultLang
+	}
+	return DefaultLang
+}
+
+func (b *Bundle) dir() string {
+	if b.Dir != "" {
+		return b.Dir
+	}
+	return TranslationDir
+}
+
+// nopLogger is used when no logger has been configured.
+var nopLogger = zap.NewNop().Sugar()
+
+func (b *Bundle) logger() *zap.SugaredLogger {
+	if b.Logger != nil {
+		return b.Logger
+	}
+	if Logger != nil {
+		return Logger
+	}
+	return nopLogger
+}
+
+// lookup returns the value for trnlVal in lang, following the fallback chain if it is missing or empty. The language
+// the value was found in is also returned, and the result is recorded in the bundle's stats.
+func (b *Bundle) lookup(lang string, trnlVal string) (Value, string, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, l := range b.chain(lang) {
+		if v := b.data[l][trnlVal]; v.Value != "" {
+			b.record(lang, l)
+			return v, l, true
+		}
+	}
+	b.record(lang, "")
+	return Value{}, lang, false
+}
+
+// record updates the stats of lang, after a string was found in foundLang. An empty foundLang is a miss.
+func (b *Bundle) record(lang string, foundLang string) {
+	if foundLang == "" {
+		atomic.AddInt64(&b.stats(lang).misses, 1)
+	} else if !strings.EqualFold(lang, foundLang) {
+		atomic.AddInt64(&b.stats(lang).fallbacks, 1)
+	}
+}
+
+// get returns the raw value stored for trnlVal in lang, without any fallback.
+func (b *Bundle) get(lang string, trnlVal string) (Value, bool) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	v, ok := b.data[lang][trnlVal]
+	return v, ok
+}
+
+// values returns a copy of all the values loaded for lang.
+func (b *Bundle) values(lang string) map[string]Value {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	vals := make(map[string]Value, len(b.data[lang]))
+	for k, v := range b.data[lang] {
+		vals[k] = v
+	}
+	return vals
+}
+
+// count returns the highest counter loaded for moduleName.
+func (b *Bundle) count(moduleName string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return b.dataCount[moduleName]
+}
+
+// next increments and returns the counter for moduleName.
+func (b *Bundle) next(moduleName string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.dataCount[moduleName]++
+	return b.dataCount[moduleName]
+}
+
+func (b *Bundle) Trnl(lang string, trnlVal string) string {
+	v, _, ok := b.lookup(lang, trnlVal)
+	if !ok {
+		return b.missing(lang, trnlVal)
 	}
 	return v.Value
 }
 
-func Trnlf(lang string, trnlVal string, dataMap map[string]string) string {
-	var replData []string
-	for k, v := range dataMap {
-		replData = append(replData, "{"+k+"}", v)
+// Trnlf translates a string and fills in its arguments from dataMap. Values can use ICU MessageFormat syntax, such as
+// "{gender, select, female {She} other {They}} joined" or "{1, plural, one {# file} other {# files}}".
+func (b *Bundle) Trnlf(lang string, trnlVal string, dataMap map[string]string) string {
+	v, l, ok := b.lookup(lang, trnlVal)
+	if !ok {
+		return b.missing(lang, trnlVal)
 	}
-	repl := strings.NewReplacer(replData...)
-	v, ok := data[lang][trnlVal]
-	if !ok || v.Value == "" {
-		return repl.Replace(data[DefaultLang][trnlVal].Value)
+	return v.template().format(l, stringArgs(dataMap))
+}
+
+// Trnlfv is like TrnlfArgs, but takes its arguments positionally: {1} is the first argument, {2} the second, and so on.
+func (b *Bundle) Trnlfv(lang string, trnlVal string, args ...interface{}) string {
+	v, l, ok := b.lookup(lang, trnlVal)
+	if !ok {
+		return b.missing(lang, trnlVal)
 	}
-	return repl.Replace(v.Value)
+	return v.template().format(l, positionalArgs(args))
 }
 
-func Add(text string) string {
-	Logger.Warn("unloaded translation string for Add()")
-	return text
+// TrnlfArgs is like Trnlf, but keeps the argument types so that typed placeholders such as {1,number},
+// {2,currency,EUR}, {3,date,short} and {4,percent} can be formatted for the language. Untyped numbers and dates are
+// formatted for the language too.
+func (b *Bundle) TrnlfArgs(lang string, trnlVal string, args map[string]interface{}) string {
+	v, l, ok := b.lookup(lang, trnlVal)
+	if !ok {
+		return b.missing(lang, trnlVal)
+	}
+	return v.template().format(l, typedArgs(args))
 }
 
-func Addf(text string, format ...interface{}) string {
-	Logger.Warn("unloaded translation string for Addf()")
-	return fmt.Sprintf(text, format...)
+// moduleFile returns the path of the translation file for moduleName in lang, relative to the translation root.
+// Paths which would escape the language directory are rejected.
+func moduleFile(lang string, moduleName string) (string, error) {
+	if !fs.ValidPath(lang) || strings.Contains(lang, "/") || lang == "." {
+		return "", fmt.Errorf("invalid language directory %q", lang)
+	}
+	moduleName = filepath.ToSlash(moduleName)
+	fpath := path.Join(lang, strings.TrimSuffix(moduleName, path.Ext(moduleName))+".xml")
+	if !fs.ValidPath(fpath) || !strings.HasPrefix(fpath, lang+"/") {
+		return "", fmt.Errorf("module %q is outside of the %s translation directory", moduleName, lang)
+	}
+	return fpath, nil
 }
 
-func LoadAll(defLang string) {
-	base := path.Join(translationDir, defLang)
-	err := filepath.Walk(base,
-		func(fpath string, info os.FileInfo, err error) error {
+// dirFS returns the filesystem rooted at the bundle's translation directory on disk.
+func (b *Bundle) dirFS() fs.FS {
+	return os.DirFS(b.dir())
+}
+
+// LoadErrors holds every problem found while loading translations.
+type LoadErrors []error
+
+func (e LoadErrors) Error() string {
+	if len(e) == 1 {
+		return e[0].Error()
+	}
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return fmt.Sprintf("%d errors loading translations: %s", len(e), strings.Join(msgs, "; "))
+}
+
+func (e LoadErrors) Unwrap() []error {
+	return e
+}
+
+// add appends err, flattening any nested LoadErrors.
+func (e *LoadErrors) add(err error) {
+	var errs LoadErrors
+	if err == nil {
+		return
+	} else if errors.As(err, &errs) {
+		*e = append(*e, errs...)
+	} else {
+		*e = append(*e, err)
+	}
+}
+
+// err returns nil if no errors were added.
+func (e LoadErrors) err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// logLoadErr logs every error found by one of the error-returning loaders.
+func (b *Bundle) logLoadErr(err error) {
+	var errs LoadErrors
+	if err == nil {
+		return
+	} else if !errors.As(err, &errs) {
+		errs = LoadErrors{err}
+	}
+	for _, e := range errs {
+		b.logger().Error(e)
+	}
+}
+
+func (b *Bundle) LoadAll(defLang string) {
+	b.logLoadErr(b.LoadAllE(defLang))
+}
+
+// LoadAllE is like LoadAll, but returns every error found instead of logging it.
+func (b *Bundle) LoadAllE(defLang string) error {
+	return b.LoadAllFSE(b.dirFS(), defLang)
+}
+
+// LoadAllFS loads every module found for defLang in fsys, in all available languages.
+func (b *Bundle) LoadAllFS(fsys fs.FS, defLang string) {
+	b.logLoadErr(b.LoadAllFSE(fsys, defLang))
+}
+
+// LoadAllFSE is like LoadAllFS, but returns every error found instead of logging it.
+func (b *Bundle) LoadAllFSE(fsys fs.FS, defLang string) error {
+	return b.remember(loader{
+		fsys: fsys, kind: "LoadAllFS", lang: defLang,
+		load: func(b *Bundle) error {
+			return b.loadAllFS(fsys, defLang)
+		},
+	})
+}
+
+func (b *Bundle) loadAllFS(fsys fs.FS, defLang string) error {
+	var errs LoadErrors
+	err := fs.WalkDir(fsys, defLang,
+		func(fpath string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if info.IsDir() {
+			if d.IsDir() {
 				return nil
 			}
-			relPath, err := filepath.Rel(base, fpath)
-			if err != nil {
-				Logger.With(zap.Error(err)).Errorf("Could not get relative path of %s", fpath)
-			}
-			Load(relPath)
+			errs.add(b.loadFS(fsys, strings.TrimPrefix(fpath, defLang+"/")))
 			return nil
 		})
 	if err != nil {
-		Logger.With(zap.Error(err)).Errorf("Failed to walk translations directory %s", base)
+		errs.add(fmt.Errorf("failed to walk translations directory %s: %w", defLang, err))
 	}
+	return errs.err()
 }
 
-func LoadLangAll(lang string) {
-	base := path.Join(translationDir, lang)
-	err := filepath.Walk(base,
-		func(fpath string, info os.FileInfo, err error) error {
+func (b *Bundle) LoadLangAll(lang string) {
+	b.logLoadErr(b.LoadLangAllE(lang))
+}
+
+// LoadLangAllE is like LoadLangAll, but returns every error found instead of logging it.
+func (b *Bundle) LoadLangAllE(lang string) error {
+	return b.LoadLangAllFSE(b.dirFS(), lang)
+}
+
+// LoadLangAllFS loads every module found for lang in fsys.
+func (b *Bundle) LoadLangAllFS(fsys fs.FS, lang string) {
+	b.logLoadErr(b.LoadLangAllFSE(fsys, lang))
+}
+
+// LoadLangAllFSE is like LoadLangAllFS, but returns every error found instead of logging it.
+func (b *Bundle) LoadLangAllFSE(fsys fs.FS, lang string) error {
+	return b.remember(loader{
+		fsys: fsys, kind: "LoadLangAllFS", lang: lang,
+		load: func(b *Bundle) error {
+			return b.loadLangAllFS(fsys, lang)
+		},
+	})
+}
+
+func (b *Bundle) loadLangAllFS(fsys fs.FS, lang string) error {
+	var errs LoadErrors
+	err := fs.WalkDir(fsys, lang,
+		func(fpath string, d fs.DirEntry, err error) error {
 			if err != nil {
 				return err
 			}
-			if info.IsDir() {
+			if d.IsDir() {
 				return nil
 			}
-			relPath, err := filepath.Rel(base, fpath)
-			if err != nil {
-				Logger.With(zap.Error(err)).Errorf("Could not get relative path of %s", fpath)
-			}
-			LoadLangModule(lang, relPath)
-			// Load(info.Name())
+			errs.add(b.loadLangModuleFS(fsys, lang, strings.TrimPrefix(fpath, lang+"/")))
 			return nil
 		})
 	if err != nil {
-		Logger.With(zap.Error(err)).Errorf("Failed to walk translations directory %s", base)
+		errs.add(fmt.Errorf("failed to walk translations directory %s: %w", lang, err))
 	}
+	return errs.err()
 }
 
-func LoadLangModule(lang string, moduleName string) {
-	f, err := os.Open(path.Join(translationDir, lang, strings.TrimSuffix(moduleName, path.Ext(moduleName))+".xml"))
+func (b *Bundle) LoadLangModule(lang string, moduleName string) {
+	b.logLoadErr(b.LoadLangModuleE(lang, moduleName))
+}
+
+// LoadLangModuleE is like LoadLangModule, but returns every error found instead of logging it.
+func (b *Bundle) LoadLangModuleE(lang string, moduleName string) error {
+	return b.LoadLangModuleFSE(b.dirFS(), lang, moduleName)
+}
+
+// LoadLangModuleFS loads a single module for lang from fsys.
+func (b *Bundle) LoadLangModuleFS(fsys fs.FS, lang string, moduleName string) {
+	b.logLoadErr(b.LoadLangModuleFSE(fsys, lang, moduleName))
+}
+
+// LoadLangModuleFSE is like LoadLangModuleFS, but returns every error found instead of logging it. Besides files
+// which can't be read or decoded, it reports duplicate names, and ids or placeholders which don't match the default
+// language. Valid rows are still loaded when there are errors.
+func (b *Bundle) LoadLangModuleFSE(fsys fs.FS, lang string, moduleName string) error {
+	return b.remember(loader{
+		fsys: fsys, kind: "LoadLangModuleFS", lang: lang, module: moduleName,
+		load: func(b *Bundle) error {
+			return b.loadLangModuleFS(fsys, lang, moduleName)
+		},
+	})
+}
+
+func (b *Bundle) loadLangModuleFS(fsys fs.FS, lang string, moduleName string) error {
+	fpath, err := moduleFile(lang, moduleName)
+	if err != nil {
+		return err
+	}
+	f, err := fsys.Open(fpath)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
 		}
-		Logger.With(zap.Error(err)).Errorf("Failed to open file at %s", moduleName)
-		return
+		return fmt.Errorf("failed to open %s: %w", fpath, err)
 	}
 	defer f.Close()
 	dec := xml.NewDecoder(f)
 	var xmlData Translation
 	err = dec.Decode(&xmlData)
 	if err != nil {
-		Logger.With(zap.Error(err)).Errorf("Failed to decode data for %s", moduleName)
-		return
+		return fmt.Errorf("failed to decode %s: %w", fpath, err)
+	}
+
+	// parse messages before locking, so readers are only blocked while the catalog is updated.
+	for i := range xmlData.Rows {
+		xmlData.Rows[i].compile()
 	}
+	errs := b.validate(fpath, lang, xmlData.Rows)
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
 	for _, row := range xmlData.Rows {
-		if _, ok := data[path.Base(lang)]; !ok {
-			data[path.Base(lang)] = make(map[string]Value)
+		if _, ok := b.data[lang]; !ok {
+			b.data[lang] = make(map[string]Value)
+			b.languages = nil
+			b.cache = &langCache{}
 		}
 		if row.Name == "" { // ignore empties
 			continue
 		}
-		data[path.Base(lang)][row.Name] = row
+		b.data[lang][row.Name] = row
 	}
 	count := xmlData.Counter
 	if count <= 0 {
 		count = len(xmlData.Rows)
 	}
-	if dataCount[moduleName] < count {
-		dataCount[moduleName] = count
+	if b.dataCount[moduleName] < count {
+		b.dataCount[moduleName] = count
 	}
+	return errs.err()
 }
 
-func Load(moduleToLoad string) {
-	files, err := ioutil.ReadDir(translationDir)
+// validate checks the rows of a translation file for duplicates, and compares them to the loaded default language.
+func (b *Bundle) validate(fpath string, lang string, rows []Value) LoadErrors {
+	var errs LoadErrors
+	seen := make(map[string]bool, len(rows))
+	for _, row := range rows {
+		if row.Name == "" {
+			continue
+		}
+		if seen[row.Name] {
+			errs.add(fmt.Errorf("%s: duplicate name '%s'", fpath, row.Name))
+		}
+		seen[row.Name] = true
+	}
+
+	defLang := b.defaultLang()
+	if lang == defLang {
+		return errs
+	}
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, row := range rows {
+		def, ok := b.data[defLang][row.Name]
+		if row.Name == "" || !ok {
+			continue
+		}
+		if def.Id != row.Id {
+			errs.add(fmt.Errorf("%s: '%s' has id %d, but %d in default language %s", fpath, row.Name, row.Id, def.Id, defLang))
+		}
+		if row.Value != "" && def.Value != "" {
+			if err := checkCurlies(def.Value, row.Value); err != nil {
+				errs.add(fmt.Errorf("%s: '%s' placeholder mismatch: %w", fpath, row.Name, err))
+			}
+		}
+		for _, p := range row.Plurals {
+			defPlural, ok := def.plural(p.Form)
+			if !ok {
+				defPlural, ok = def.plural("other")
+			}
+			if !ok || p.Value == "" {
+				continue
+			}
+			if err := checkCurlies(defPlural, p.Value); err != nil {
+				errs.add(fmt.Errorf("%s: '%s[%s]' placeholder mismatch: %w", fpath, row.Name, p.Form, err))
+			}
+		}
+	}
+	return errs
+}
+
+func (b *Bundle) Load(moduleToLoad string) {
+	b.logLoadErr(b.LoadE(moduleToLoad))
+}
+
+// LoadE is like Load, but returns every error found instead of logging it.
+func (b *Bundle) LoadE(moduleToLoad string) error {
+	return b.LoadFSE(b.dirFS(), moduleToLoad)
+}
+
+// LoadFS loads a module in every language directory found at the root of fsys.
+func (b *Bundle) LoadFS(fsys fs.FS, moduleToLoad string) {
+	b.logLoadErr(b.LoadFSE(fsys, moduleToLoad))
+}
+
+// LoadFSE is like LoadFS, but returns every error found instead of logging it. The default language is loaded first,
+// so the other languages can be validated against it.
+func (b *Bundle) LoadFSE(fsys fs.FS, moduleToLoad string) error {
+	return b.remember(loader{
+		fsys: fsys, kind: "LoadFS", module: moduleToLoad,
+		load: func(b *Bundle) error {
+			return b.loadFS(fsys, moduleToLoad)
+		},
+	})
+}
+
+func (b *Bundle) loadFS(fsys fs.FS, moduleToLoad string) error {
+	files, err := fs.ReadDir(fsys, ".")
 	if err != nil {
-		if os.IsNotExist(err) {
-			return
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
 		}
+		return fmt.Errorf("failed to load %s: %w", moduleToLoad, err)
+	}
 
-		Logger.With(zap.Error(err)).Errorf("failed to load %s", moduleToLoad)
-		return
+	var errs LoadErrors
+	defLang := b.defaultLang()
+	for _, x := range files {
+		if x.IsDir() && x.Name() == defLang {
+			errs.add(b.loadLangModuleFS(fsys, defLang, moduleToLoad))
+		}
 	}
 	for _, x := range files {
-		if !x.IsDir() || strings.HasPrefix(x.Name(), ".") {
+		if !x.IsDir() || strings.HasPrefix(x.Name(), ".") || x.Name() == defLang {
 			// if not a directory, or is hidden, skip
 			continue
 		}
 
-		LoadLangModule(x.Name(), moduleToLoad)
+		errs.add(b.loadLangModuleFS(fsys, x.Name(), moduleToLoad))
 	}
+	return errs.err()
 }
 
-func Languages() (ss []string) {
-	if languages != nil {
-		return languages
+func (b *Bundle) Languages() []string {
+	b.mu.RLock()
+	ss := b.languages
+	b.mu.RUnlock()
+	if ss != nil {
+		return ss
 	}
-	for k := range data {
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for k := range b.data {
 		ss = append(ss, k)
 	}
 	sort.Strings(ss)
-	languages = ss
+	b.languages = ss
 	return ss
 }
 
-func IsLangSupported(s string) bool {
-	_, ok := data[s]
+func (b *Bundle) IsLangSupported(s string) bool {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	_, ok := b.data[s]
 	return ok
 }
+
+func Trnl(lang string, trnlVal string) string {
+	return std.Trnl(lang, trnlVal)
+}
+
+func Trnlf(lang string, trnlVal string, dataMap map[string]string) string {
+	return std.Trnlf(lang, trnlVal, dataMap)
+}
+
+func Trnlfv(lang string, trnlVal string, args ...interface{}) string {
+	return std.Trnlfv(lang, trnlVal, args...)
+}
+
+func TrnlfArgs(lang string, trnlVal string, args map[string]interface{}) string {
+	return std.TrnlfArgs(lang, trnlVal, args)
+}
+
+func Add(text string) string {
+	std.logger().Warn("unloaded translation string for Add()")
+	return text
+}
+
+func Addf(text string, format ...interface{}) string {
+	std.logger().Warn("unloaded translation string for Addf()")
+	return fmt.Sprintf(text, format...)
+}
+
+// AddCtx marks text for extraction, like Add, in a context which tells it apart from identical texts with another
+// meaning.
+func AddCtx(context string, text string) string {
+	std.logger().Warn("unloaded translation string for AddCtx()")
+	return text
+}
+
+// AddCtxf is like AddCtx, for format strings.
+func AddCtxf(context string, text string, format ...interface{}) string {
+	std.logger().Warn("unloaded translation string for AddCtxf()")
+	return fmt.Sprintf(text, format...)
+}
+
+func LoadAll(defLang string) {
+	std.LoadAll(defLang)
+}
+
+func LoadAllE(defLang string) error {
+	return std.LoadAllE(defLang)
+}
+
+func LoadLangAll(lang string) {
+	std.LoadLangAll(lang)
+}
+
+func LoadLangAllE(lang string) error {
+	return std.LoadLangAllE(lang)
+}
+
+func LoadLangModule(lang string, moduleName string) {
+	std.LoadLangModule(lang, moduleName)
+}
+
+func LoadLangModuleE(lang string, moduleName string) error {
+	return std.LoadLangModuleE(lang, moduleName)
+}
+
+func Load(moduleToLoad string) {
+	std.Load(moduleToLoad)
+}
+
+func LoadE(moduleToLoad string) error {
+	return std.LoadE(moduleToLoad)
+}
+
+// LoadAllFS loads all modules from fsys into the default bundle. fsys must be rooted at the translation directory;
+// when embedding, use fs.Sub to strip the directory name:
+//
+//	//go:embed trans
+//	var transFiles embed.FS
+//
+//	func init() {
+//		trans, _ := fs.Sub(transFiles, "trans")
+//		goloc.LoadAllFS(trans, "en-GB")
+//	}
+func LoadAllFS(fsys fs.FS, defLang string) {
+	std.LoadAllFS(fsys, defLang)
+}
+
+func LoadAllFSE(fsys fs.FS, defLang string) error {
+	return std.LoadAllFSE(fsys, defLang)
+}
+
+func LoadLangAllFS(fsys fs.FS, lang string) {
+	std.LoadLangAllFS(fsys, lang)
+}
+
+func LoadLangAllFSE(fsys fs.FS, lang string) error {
+	return std.LoadLangAllFSE(fsys, lang)
+}
+
+func LoadLangModuleFS(fsys fs.FS, lang string, moduleName string) {
+	std.LoadLangModuleFS(fsys, lang, moduleName)
+}
+
+func LoadLangModuleFSE(fsys fs.FS, lang string, moduleName string) error {
+	return std.LoadLangModuleFSE(fsys, lang, moduleName)
+}
+
+func LoadFS(fsys fs.FS, moduleToLoad string) {
+	std.LoadFS(fsys, moduleToLoad)
+}
+
+func LoadFSE(fsys fs.FS, moduleToLoad string) error {
+	return std.LoadFSE(fsys, moduleToLoad)
+}
+
+func Languages() []string {
+	return std.Languages()
+}
+
+func IsLangSupported(s string) bool {
+	return std.IsLangSupported(s)
+}
@@ -0,0 +1,57 @@
+package goloc
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+const benchModule = `<?xml version="1.0" encoding="UTF-8"?>
+<translation>
+    <Rows id="1" name="bench.go:1">
+        <value>Hello {1}, you have {2} new messages from {3}</value>
+    </Rows>
+    <Counter>1</Counter>
+</translation>
+`
+
+// BenchmarkTrnlf compares the compiled templates with the strings.Replacer that Trnlf used to build on every call.
+func BenchmarkTrnlf(b *testing.B) {
+	bundle := NewBundle("en-GB")
+	fsys := fstest.MapFS{"en-GB/bench.xml": {Data: []byte(benchModule)}}
+	if err := bundle.LoadFSE(fsys, "bench.go"); err != nil {
+		b.Fatal(err)
+	}
+	args := map[string]string{"1": "Paul", "2": "42", "3": "Alice"}
+	want := "Hello Paul, you have 42 new messages from Alice"
+
+	b.Run("replacer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			var replData []string
+			for k, v := range args {
+				replData = append(replData, "{"+k+"}", v)
+			}
+			v, _, _ := bundle.lookup("en-GB", "bench.go:1")
+			if got := strings.NewReplacer(replData...).Replace(v.Value); got != want {
+				b.Fatalf("got %q, want %q", got, want)
+			}
+		}
+	})
+	b.Run("template", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if got := bundle.Trnlf("en-GB", "bench.go:1", args); got != want {
+				b.Fatalf("got %q, want %q", got, want)
+			}
+		}
+	})
+	b.Run("variadic", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			if got := bundle.Trnlfv("en-GB", "bench.go:1", "Paul", "42", "Alice"); got != want {
+				b.Fatalf("got %q, want %q", got, want)
+			}
+		}
+	})
+}
@@ -2,75 +2,17 @@ package goloc
 
 import (
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"go/ast"
 	"go/token"
+	"go/types"
+	"io/fs"
 	"os"
-	"path"
 	"path/filepath"
 	"strconv"
-	"strings"
 )
 
-func parseFmtString(rdata []rune, ret *ast.CallExpr) (newData []rune, mapData []ast.Expr, needStrconv bool) {
-	index := 1
-	for i := 0; i < len(rdata); i++ {
-		if rdata[i] == '%' && i+1 < len(rdata) {
-			i++
-			switch x := rdata[i]; x {
-			case 's': // string -> no change
-				mapData = append(mapData,
-					&ast.KeyValueExpr{
-						Key: &ast.BasicLit{
-							Kind:  token.STRING,
-							Value: strconv.Quote(strconv.Itoa(index)),
-						},
-						Value: ret.Args[index],
-					})
-			case 'd': // int
-				mapData = append(mapData,
-					&ast.KeyValueExpr{
-						Key: &ast.BasicLit{
-							Kind:  token.STRING,
-							Value: strconv.Quote(strconv.Itoa(index)),
-						},
-						Value: &ast.CallExpr{
-							Fun: &ast.SelectorExpr{
-								X:   &ast.Ident{Name: "strconv"},
-								Sel: &ast.Ident{Name: "Itoa"},
-							},
-							Args: []ast.Expr{ret.Args[index]},
-						},
-					})
-				needStrconv = true
-			case 't': // bool
-				mapData = append(mapData,
-					&ast.KeyValueExpr{
-						Key: &ast.BasicLit{
-							Kind:  token.STRING,
-							Value: `"` + strconv.Itoa(index) + `"`,
-						},
-						Value: &ast.CallExpr{
-							Fun: &ast.SelectorExpr{
-								X:   &ast.Ident{Name: "strconv"},
-								Sel: &ast.Ident{Name: "FormatBool"},
-							},
-							Args: []ast.Expr{ret.Args[index]},
-						},
-					})
-				// case 'p': // pointer (wtaf)
-				// strconv
-			default:
-				Logger.Fatalf("no way to handle '%s' formatting yet", string(x))
-			}
-			newData = append(newData, []rune("{"+strconv.Itoa(index)+"}")...)
-			index++
-		} else {
-			newData = append(newData, rdata[i])
-		}
-	}
-	return newData, mapData, needStrconv
-}
-
 func initHasLoad(ret *ast.FuncDecl, modName string) bool {
 	for _, x := range ret.Body.List {
 		if exp, ok := x.(*ast.ExprStmt); ok {
@@ -101,77 +43,162 @@ func contains(ss []string, s string) bool {
 	return false
 }
 
-func (l *Locer) injectTran(name string, ret *ast.CallExpr, f *ast.SelectorExpr, v *ast.BasicLit) (*ast.CallExpr, bool) {
-	data, err := strconv.Unquote(v.Value)
-	if err != nil {
-		Logger.Fatal(err)
-		return nil, false
+// replaceText returns the arguments of a call, with the text at spec.text replaced by trnl. The format arguments of
+// format calls are dropped, since the translation formats them.
+func replaceText(args []ast.Expr, spec funcSpec, fmtCall bool, trnl ast.Expr) []ast.Expr {
+	end := len(args)
+	if fmtCall && spec.args < end {
+		end = spec.args
 	}
-	needStrConvImport := false
+	out := append([]ast.Expr(nil), args[:end]...)
+	out[spec.text] = trnl
+	return out
+}
 
-	itemName, isDup := noDupStrings[data]
-	if !isDup {
-		dataCount[name]++
-		itemName = name + ":" + strconv.Itoa(dataCount[name])
-		noDupStrings[data] = itemName
-		newDataNames[name] = append(newDataNames[name], itemName)
-	}
+// placeAt positions the generated nodes of expr, which have none, at the text they replace, from pos to end. Without
+// positions, the printer would move the comments following the text, such as notes for translators, into expr.
+func placeAt(expr ast.Expr, pos token.Pos, end token.Pos) {
+	ast.Inspect(expr, func(n ast.Node) bool {
+		switch n := n.(type) {
+		case *ast.Ident:
+			if !n.NamePos.IsValid() {
+				n.NamePos = pos
+			}
+		case *ast.BasicLit:
+			if !n.ValuePos.IsValid() {
+				n.ValuePos = pos
+			}
+		case *ast.CallExpr:
+			if !n.Lparen.IsValid() {
+				n.Lparen, n.Rparen = pos, end-1
+			}
+		case *ast.CompositeLit:
+			if !n.Lbrace.IsValid() {
+				n.Lbrace, n.Rbrace = pos, end-1
+			}
+		case *ast.MapType:
+			if !n.Map.IsValid() {
+				n.Map = pos
+			}
+		case *ast.KeyValueExpr:
+			if !n.Colon.IsValid() {
+				n.Colon = pos
+			}
+		}
+		return true
+	})
+}
 
-	args := []ast.Expr{
-		&ast.Ident{Name: "lang"},
-		&ast.BasicLit{
-			Kind:  token.STRING,
-			Value: strconv.Quote(itemName),
-		},
-	}
+// addFunc is a goloc function which marks its text for extraction, without translating it yet.
+type addFunc struct {
+	text    int  // index of the text argument
+	fmtCall bool // the text is a format string, followed by its arguments
+	context bool // the first argument is the context of the text
+}
+
+var addFuncs = map[string]addFunc{
+	"Add":     {text: 0},
+	"Addf":    {text: 0, fmtCall: true},
+	"AddCtx":  {text: 1, context: true},
+	"AddCtxf": {text: 1, fmtCall: true, context: true},
+}
+
+// contextFuncs maps each translation function to its context.Context equivalent.
+var contextFuncs = map[string]string{
+	"Trnl":   "T",
+	"Trnlf":  "Tf",
+	"Trnlfv": "Tfv",
+}
+
+// injectTran registers the text data, and returns the translation call which replaces it along with any packages the
+// call needs. Format strings which can't be converted are returned as errors, before anything is registered.
+func (l *Locer) injectTran(info *types.Info, name string, data string, fmtArgs []ast.Expr, fmtCall bool, src langSource, hint keyHint) (*ast.CallExpr, []string, error) {
+	rawData := data
 
 	methToCall := "Trnl"
-	if contains(l.Fmtfuncs, f.Sel.Name) || f.Sel.Name == "Addf" { // is a format call
+	var extraArgs []ast.Expr
+	var imports []string
+	if fmtCall {
 		methToCall = "Trnlf"
-		dataNew, mapData, needStrconv := parseFmtString([]rune(data), ret)
-		needStrConvImport = needStrconv
+		dataNew, mapData, needImports, err := parseFmtString(info, []rune(data), fmtArgs, l.Variadic, l.LocaleNumbers)
+		if err != nil {
+			return nil, nil, err
+		}
+		imports = needImports
 
 		data = string(dataNew)
-		args = append(args, &ast.CompositeLit{
-			Type: &ast.MapType{
-				Key: &ast.BasicLit{
-					Kind:  token.STRING,
-					Value: "string",
-				},
-				Value: &ast.BasicLit{
-					Kind:  token.STRING,
-					Value: "string",
+		if l.Variadic {
+			methToCall = "Trnlfv"
+			extraArgs = mapData
+		} else {
+			extraArgs = []ast.Expr{&ast.CompositeLit{
+				Type: &ast.MapType{
+					Key: &ast.BasicLit{
+						Kind:  token.STRING,
+						Value: "string",
+					},
+					Value: &ast.BasicLit{
+						Kind:  token.STRING,
+						Value: "string",
+					},
 				},
-			},
-			Elts: mapData,
-		})
+				Elts: mapData,
+			}}
+		}
 	}
 
+	itemName, isDup := noDupStrings[dedupKey(rawData, hint.context)]
+	if !isDup {
+		itemName = l.newKey(name, l.catalog().next(name), data, hint)
+		l.useKey(itemName, dedupKey(data, hint.context))
+		noDupStrings[dedupKey(rawData, hint.context)] = itemName
+		newDataNames[name] = append(newDataNames[name], itemName)
+	}
+
+	args := append([]ast.Expr{
+		&ast.Ident{Name: src.name},
+		&ast.BasicLit{
+			Kind:  token.STRING,
+			Value: strconv.Quote(itemName),
+		},
+	}, extraArgs...)
+
 	if !isDup {
 		for lang := range newData {
 			newData[lang][name][itemName] = Value{
-				Id:      dataCount[name],
+				Id:      l.catalog().count(name),
 				Name:    itemName,
+				Context: hint.context,
 				Value:   "",
+				Note:    hint.note,
+				Refs:    []SourceRef{hint.ref},
 				Comment: data,
 			}
 		}
 		// set data only for default value
 		newData[l.DefaultLang][name][itemName] = Value{
-			Id:      dataCount[name],
+			Id:      l.catalog().count(name),
 			Name:    itemName,
+			Context: hint.context,
 			Value:   data,
+			Note:    hint.note,
+			Refs:    []SourceRef{hint.ref},
 			Comment: itemName,
 		}
+	} else {
+		addRef(name, itemName, hint)
 	}
 
+	if src.isCtx {
+		methToCall = contextFuncs[methToCall]
+	}
 	return &ast.CallExpr{
 		Fun: &ast.SelectorExpr{
 			X:   &ast.Ident{Name: "goloc"},
 			Sel: &ast.Ident{Name: methToCall},
 		},
 		Args: args,
-	}, needStrConvImport
+	}, imports, nil
 }
 
 func stringSlicesEqual(a, b []string) bool {
@@ -193,7 +220,10 @@ func stringSlicesEqual(a, b []string) bool {
 func (l *Locer) saveMap(newData map[string]map[string]map[string]Value, newDataNames map[string][]string) error {
 	for lang, filenameMap := range newData {
 		for modName, modData := range filenameMap {
-			names := loadOriginalModuleOrder(modName)
+			names, err := l.loadOriginalModuleOrder(modName)
+			if err != nil {
+				return err
+			}
 			newNames := newDataNames[modName]
 			if len(names) < len(newNames) || !stringSlicesEqual(names[len(names)-len(newNames):], newNames) {
 				names = append(names, newNames...)
@@ -216,15 +246,18 @@ func (l *Locer) saveMap(newData map[string]map[string]map[string]Value, newDataN
 
 				xmlOutput.Rows = append(xmlOutput.Rows, langData)
 			}
-			xmlOutput.Counter = dataCount[modName]
+			xmlOutput.Counter = l.catalog().count(modName)
 
-			err := func() error {
+			err = func() error {
 				// TODO: other filetypes than xml
 				w := os.Stdout
 				if l.Apply {
-					// TODO: choose translationDir
-					xmlName := strings.TrimSuffix(path.Join(translationDir, lang, modName), path.Ext(modName)) + ".xml"
-					err := os.MkdirAll(filepath.Dir(xmlName), 0755)
+					fpath, err := moduleFile(lang, modName)
+					if err != nil {
+						return err
+					}
+					xmlName := filepath.Join(l.dir(), filepath.FromSlash(fpath))
+					err = os.MkdirAll(filepath.Dir(xmlName), 0755)
 					if err != nil {
 						return err
 					}
@@ -253,24 +286,27 @@ func (l *Locer) saveMap(newData map[string]map[string]map[string]Value, newDataN
 	return nil
 }
 
-func loadOriginalModuleOrder(modName string) (out []string) {
-	f, err := os.Open(path.Join(translationDir, DefaultLang, strings.TrimSuffix(modName, path.Ext(modName))+".xml"))
+func (l *Locer) loadOriginalModuleOrder(modName string) (out []string, err error) {
+	fpath, err := moduleFile(l.DefaultLang, modName)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return
+		return nil, err
+	}
+	f, err := l.catalog().dirFS().Open(fpath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
 		}
-		Logger.Fatal(err)
-		return
+		return nil, err
 	}
 	defer f.Close()
 	dec := xml.NewDecoder(f)
 	var xmlData Translation
 	err = dec.Decode(&xmlData)
 	if err != nil {
-		Logger.Fatal(err)
+		return nil, fmt.Errorf("failed to decode %s: %w", fpath, err)
 	}
 	for _, row := range xmlData.Rows {
 		out = append(out, row.Name)
 	}
-	return out
+	return out, nil
 }
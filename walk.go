@@ -0,0 +1,85 @@
+package goloc
+
+import (
+	"errors"
+	"fmt"
+	"go/ast"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/tools/go/packages"
+)
+
+// load loads the packages matching patterns, with the syntax and type information needed to extract strings.
+// Patterns which don't match anything are returned as errors; type errors are left for the caller.
+func (l *Locer) load(patterns []string) ([]*packages.Package, error) {
+	cfg := &packages.Config{
+		Mode: packages.NeedName | packages.NeedFiles | packages.NeedSyntax | packages.NeedTypes |
+			packages.NeedTypesInfo | packages.NeedImports,
+		Fset:  l.Fset,
+		Tests: l.Tests,
+	}
+	if len(l.Tags) > 0 {
+		cfg.BuildFlags = []string{"-tags=" + strings.Join(l.Tags, ",")}
+	}
+	pkgs, err := packages.Load(cfg, patterns...)
+	if err != nil {
+		return nil, err
+	}
+	for _, pkg := range pkgs {
+		for _, e := range pkg.Errors {
+			if e.Kind == packages.ListError {
+				return nil, errors.New(e.Error())
+			}
+		}
+	}
+	return pkgs, nil
+}
+
+// skipFile returns why the file with the given name shouldn't be handled, or an empty string if it should.
+func (l *Locer) skipFile(name string, f *ast.File) string {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	for _, dir := range parts[:len(parts)-1] {
+		if dir == "vendor" || dir == "testdata" {
+			return "in " + dir
+		}
+	}
+	if !l.Tests && strings.HasSuffix(name, "_test.go") {
+		return "test file"
+	}
+	if !l.Generated && ast.IsGenerated(f) {
+		return "generated file"
+	}
+	if glob := l.excluded(parts); glob != "" {
+		return "excluded by " + glob
+	}
+	return ""
+}
+
+// excluded returns the Exclude glob matching a file, given as the parts of its path. Globs are matched against the
+// whole path, every directory leading to it, and the file name.
+func (l *Locer) excluded(parts []string) string {
+	for _, glob := range l.Exclude {
+		glob = filepath.ToSlash(glob)
+		for i := range parts {
+			if ok, _ := path.Match(glob, strings.Join(parts[:i+1], "/")); ok {
+				return glob
+			}
+		}
+		if ok, _ := path.Match(glob, parts[len(parts)-1]); ok {
+			return glob
+		}
+	}
+	return ""
+}
+
+// checkExclude ensures that every Exclude glob is valid.
+func (l *Locer) checkExclude() error {
+	for _, glob := range l.Exclude {
+		if _, err := path.Match(filepath.ToSlash(glob), ""); err != nil {
+			return fmt.Errorf("invalid exclude glob %q: %w", glob, err)
+		}
+	}
+	return nil
+}